@@ -0,0 +1,146 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package events decodes the indexed chaincode events emitted by the
+// smart-contract package. Event names encode a fixed-order topic path
+// (similar to abigen's indexed event topics) so that subscribers can filter
+// on indexed fields without unmarshalling every payload.
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	topicThreadCreated = "thread.created"
+	topicVoteCast      = "vote.cast"
+	topicThreadClosed  = "thread.closed"
+)
+
+// ThreadCreatedEvent carries the non-indexed payload of a thread.created event.
+type ThreadCreatedEvent struct {
+	ThreadID    string   `json:"thread_id"`
+	Category    string   `json:"category"`
+	CreatorMSP  string   `json:"creator_msp"`
+	Theme       string   `json:"theme"`
+	Description string   `json:"description"`
+	Options     []string `json:"options"`
+}
+
+// VoteCastEvent carries the non-indexed payload of a vote.cast event. Option
+// is recovered from the payload: the topic only carries its hash.
+type VoteCastEvent struct {
+	ThreadID   string `json:"thread_id"`
+	Category   string `json:"category"`
+	Option     string `json:"option"`
+	CreatorMSP string `json:"creator_msp"`
+	VoterID    string `json:"voter_id"`
+}
+
+// ThreadClosedEvent carries the non-indexed payload of a thread.closed event.
+type ThreadClosedEvent struct {
+	ThreadID   string   `json:"thread_id"`
+	Category   string   `json:"category"`
+	CreatorMSP string   `json:"creator_msp"`
+	WinOptions []string `json:"win_options"`
+}
+
+// HashOption returns the hex-encoded sha256 digest used as the indexed
+// option topic, so callers never have to hash an option string by hand.
+func HashOption(option string) string {
+	sum := sha256.Sum256([]byte(option))
+	return hex.EncodeToString(sum[:])
+}
+
+// BuildThreadCreatedName returns the topic-encoded event name for a
+// ThreadCreated event: thread.created::<threadID>::<category>::<creatorMSP>.
+func BuildThreadCreatedName(threadID, category, creatorMSP string) string {
+	return strings.Join([]string{topicThreadCreated, threadID, category, creatorMSP}, "::")
+}
+
+// BuildVoteCastName returns the topic-encoded event name for a VoteCast
+// event: vote.cast::<threadID>::<category>::<optionHash>::<creatorMSP>.
+func BuildVoteCastName(threadID, category, option, creatorMSP string) string {
+	return strings.Join([]string{topicVoteCast, threadID, category, HashOption(option), creatorMSP}, "::")
+}
+
+// BuildThreadClosedName returns the topic-encoded event name for a
+// ThreadClosed event: thread.closed::<threadID>::<category>::<creatorMSP>.
+func BuildThreadClosedName(threadID, category, creatorMSP string) string {
+	return strings.Join([]string{topicThreadClosed, threadID, category, creatorMSP}, "::")
+}
+
+func splitTopics(name string, want int) ([]string, error) {
+	parts := strings.Split(name, "::")
+	if len(parts) != want {
+		return nil, fmt.Errorf("unexpected topic count in event name %q: got %d, want %d", name, len(parts), want)
+	}
+	return parts, nil
+}
+
+// ParseThreadCreated decodes a thread.created event from its name and payload.
+func ParseThreadCreated(name string, payload []byte) (ThreadCreatedEvent, error) {
+	parts, err := splitTopics(name, 4)
+	if err != nil {
+		return ThreadCreatedEvent{}, err
+	}
+	if parts[0] != topicThreadCreated {
+		return ThreadCreatedEvent{}, fmt.Errorf("not a %s event: %q", topicThreadCreated, name)
+	}
+
+	var ev ThreadCreatedEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return ThreadCreatedEvent{}, fmt.Errorf("failed to unmarshal thread.created payload: %v", err)
+	}
+	ev.ThreadID, ev.Category, ev.CreatorMSP = parts[1], parts[2], parts[3]
+
+	return ev, nil
+}
+
+// ParseVoteCast decodes a vote.cast event from its name and payload, and
+// checks that the option carried in the payload still hashes to the topic.
+func ParseVoteCast(name string, payload []byte) (VoteCastEvent, error) {
+	parts, err := splitTopics(name, 5)
+	if err != nil {
+		return VoteCastEvent{}, err
+	}
+	if parts[0] != topicVoteCast {
+		return VoteCastEvent{}, fmt.Errorf("not a %s event: %q", topicVoteCast, name)
+	}
+
+	var ev VoteCastEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return VoteCastEvent{}, fmt.Errorf("failed to unmarshal vote.cast payload: %v", err)
+	}
+	ev.ThreadID, ev.Category, ev.CreatorMSP = parts[1], parts[2], parts[4]
+
+	if HashOption(ev.Option) != parts[3] {
+		return VoteCastEvent{}, fmt.Errorf("option hash in payload does not match topic for event %q", name)
+	}
+
+	return ev, nil
+}
+
+// ParseThreadClosed decodes a thread.closed event from its name and payload.
+func ParseThreadClosed(name string, payload []byte) (ThreadClosedEvent, error) {
+	parts, err := splitTopics(name, 4)
+	if err != nil {
+		return ThreadClosedEvent{}, err
+	}
+	if parts[0] != topicThreadClosed {
+		return ThreadClosedEvent{}, fmt.Errorf("not a %s event: %q", topicThreadClosed, name)
+	}
+
+	var ev ThreadClosedEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		return ThreadClosedEvent{}, fmt.Errorf("failed to unmarshal thread.closed payload: %v", err)
+	}
+	ev.ThreadID, ev.Category, ev.CreatorMSP = parts[1], parts[2], parts[3]
+
+	return ev, nil
+}
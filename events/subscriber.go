@@ -0,0 +1,92 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package events
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+// Filter narrows a subscription down to events matching a given category
+// and/or thread creator MSP. Empty fields match anything, so a caller that
+// only cares about a category can leave CreatorMSP blank and vice versa.
+type Filter struct {
+	Category   string
+	CreatorMSP string
+}
+
+// Subscriber wraps a fabric-sdk-go event client and only invokes callbacks
+// for chaincode events whose topics match the configured Filter, so client
+// apps get efficient continuous subscriptions without deserializing every
+// payload on the channel.
+type Subscriber struct {
+	client *event.Client
+}
+
+// NewSubscriber wraps an already-connected fabric-sdk-go event client.
+func NewSubscriber(client *event.Client) *Subscriber {
+	return &Subscriber{client: client}
+}
+
+// OnThreadCreated invokes cb for every thread.created event whose topics
+// match filter. The returned registration must be passed to the underlying
+// event client's Unregister once the caller is done listening.
+func (s *Subscriber) OnThreadCreated(chaincodeID string, filter Filter, cb func(ThreadCreatedEvent)) (fab.Registration, error) {
+	return s.subscribe(chaincodeID, topicThreadCreated, 2, 3, filter, func(name string, payload []byte) {
+		if ev, err := ParseThreadCreated(name, payload); err == nil {
+			cb(ev)
+		}
+	})
+}
+
+// OnVoteCast invokes cb for every vote.cast event whose topics match filter.
+func (s *Subscriber) OnVoteCast(chaincodeID string, filter Filter, cb func(VoteCastEvent)) (fab.Registration, error) {
+	return s.subscribe(chaincodeID, topicVoteCast, 2, 4, filter, func(name string, payload []byte) {
+		if ev, err := ParseVoteCast(name, payload); err == nil {
+			cb(ev)
+		}
+	})
+}
+
+// OnThreadClosed invokes cb for every thread.closed event whose topics
+// match filter.
+func (s *Subscriber) OnThreadClosed(chaincodeID string, filter Filter, cb func(ThreadClosedEvent)) (fab.Registration, error) {
+	return s.subscribe(chaincodeID, topicThreadClosed, 2, 3, filter, func(name string, payload []byte) {
+		if ev, err := ParseThreadClosed(name, payload); err == nil {
+			cb(ev)
+		}
+	})
+}
+
+// subscribe registers a chaincode event listener matching on the topic
+// prefix and forwards only the events whose category/creator-MSP topics
+// (at categoryIdx/creatorIdx) satisfy filter to handle.
+func (s *Subscriber) subscribe(chaincodeID, topic string, categoryIdx, creatorIdx int, filter Filter, handle func(name string, payload []byte)) (fab.Registration, error) {
+	reg, notifier, err := s.client.RegisterChaincodeEvent(chaincodeID, regexp.QuoteMeta(topic)+"::.*")
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for ev := range notifier {
+			topics := strings.Split(ev.EventName, "::")
+			if len(topics) <= creatorIdx {
+				continue
+			}
+			if filter.Category != "" && topics[categoryIdx] != filter.Category {
+				continue
+			}
+			if filter.CreatorMSP != "" && topics[creatorIdx] != filter.CreatorMSP {
+				continue
+			}
+			handle(ev.EventName, ev.Payload)
+		}
+	}()
+
+	return reg, nil
+}
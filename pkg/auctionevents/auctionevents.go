@@ -0,0 +1,121 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package auctionevents consumes the typed, indexed chaincode events emitted
+// by smart-contract's emitTypedEvent: a stable event name per type (e.g.
+// "AnonVoteCast") carrying a topic0..topicN header - topic0 the event name,
+// topic1..N the hex sha256 digest of each indexed field, in declaration
+// order - and a JSON data blob. Unlike the events package (which encodes its
+// topics directly into a per-thread dynamic event name), every instance of a
+// type here shares one event name, so a subscriber registers once and
+// filters by comparing a candidate value's own hash against the recorded
+// topic hash - the same opaqueness an indexed dynamic-length field has under
+// go-ethereum/abigen.
+package auctionevents
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-sdk-go/pkg/client/event"
+	"github.com/hyperledger/fabric-sdk-go/pkg/common/providers/fab"
+)
+
+const (
+	eventAnonThreadCreated = "AnonThreadCreated"
+	eventAnonVoteCast      = "AnonVoteCast"
+	eventAnonThreadClosed  = "AnonThreadClosed"
+	eventMaliciousAnonVote = "MaliciousAnonVote"
+)
+
+// envelope mirrors the wire format emitTypedEvent writes.
+type envelope struct {
+	Topics []string        `json:"topics"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// hashTopic returns the hex sha256 digest emitTypedEvent would have recorded
+// for value, so callers can filter by an indexed field's plaintext without
+// it ever having to appear on-chain in the clear.
+func hashTopic(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// decode parses payload into an envelope and checks its topic0 matches name.
+func decode(name string, payload []byte) (envelope, error) {
+	var env envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
+		return envelope{}, fmt.Errorf("failed to unmarshal %s payload: %v", name, err)
+	}
+	if len(env.Topics) == 0 || env.Topics[0] != name {
+		return envelope{}, fmt.Errorf("not a %s event", name)
+	}
+	return env, nil
+}
+
+// AnonThreadClosedData is the non-indexed payload of an AnonThreadClosed event.
+type AnonThreadClosedData struct {
+	WinOption string `json:"win_option"`
+}
+
+// FilterAnonVoteCast registers for AnonVoteCast events and invokes cb only
+// for those cast on threadID. Every AnonVoteCast event is still delivered
+// and its envelope decoded; the thread is matched on topic1.
+func FilterAnonVoteCast(client *event.Client, chaincodeID string, threadID string, cb func()) (fab.Registration, error) {
+	wantTopic := hashTopic(threadID)
+
+	reg, notifier, err := client.RegisterChaincodeEvent(chaincodeID, eventAnonVoteCast)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for ev := range notifier {
+			env, err := decode(eventAnonVoteCast, ev.Payload)
+			if err != nil || len(env.Topics) < 2 || env.Topics[1] != wantTopic {
+				continue
+			}
+			cb()
+		}
+	}()
+
+	return reg, nil
+}
+
+// FilterAnonThreadClosed registers for AnonThreadClosed events and invokes
+// cb only for threads created by creatorMSP, decoding WinOption from the
+// event's data blob. cb's first argument is the closing transaction's ID,
+// not the thread's - ThreadID is indexed but never carried in the clear
+// anywhere in this event, so a listener that needs it must already know it
+// (e.g. from the AnonThreadCreated event that preceded it) rather than read
+// it off this callback.
+func FilterAnonThreadClosed(client *event.Client, chaincodeID string, creatorMSP string, cb func(txID string, data AnonThreadClosedData)) (fab.Registration, error) {
+	wantTopic := hashTopic(creatorMSP)
+
+	reg, notifier, err := client.RegisterChaincodeEvent(chaincodeID, eventAnonThreadClosed)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for ev := range notifier {
+			env, err := decode(eventAnonThreadClosed, ev.Payload)
+			if err != nil || len(env.Topics) < 4 || env.Topics[3] != wantTopic {
+				continue
+			}
+
+			var data AnonThreadClosedData
+			if err := json.Unmarshal(env.Data, &data); err != nil {
+				continue
+			}
+
+			cb(ev.TxID, data)
+		}
+	}()
+
+	return reg, nil
+}
@@ -0,0 +1,191 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// beaconBootstrapCollection is a well-known private data collection,
+// distinct from the per-organization implicit collections returned by
+// getCollectionName, holding the channel-wide drand beacon configuration
+// EndAnonThread uses to break a tie. It must be defined in the chaincode's
+// collections config like any other private data collection.
+const beaconBootstrapCollection = "beaconBootstrap"
+
+// beaconBootstrapKey is the single key under beaconBootstrapCollection that
+// GetBeaconPublicKey/SetBeaconPublicKey read and write.
+const beaconBootstrapKey = "drand"
+
+// BeaconEntry is one round of a drand-style randomness beacon, submitted in
+// EndData's transient payload to deterministically break a tie between an
+// AnonThread's top options. drand itself signs with BLS12-381 pairings; to
+// keep this contract free of external cryptography dependencies (see
+// verifyBeaconSignature in beacon.go), the configured beacon is expected to
+// sign with ed25519 instead.
+type BeaconEntry struct {
+	Round         uint64 `json:"round"`
+	Signature     []byte `json:"signature"`
+	PrevSignature []byte `json:"prev_signature"`
+}
+
+// beaconBootstrap is the channel-wide drand configuration: the beacon's
+// public key, and the genesis time/period needed to derive which round a
+// given close-block timestamp must use, so a stale or premature entry can be
+// rejected outright rather than merely checked for monotonicity.
+type beaconBootstrap struct {
+	PublicKey   []byte `json:"public_key"`
+	GenesisTime int64  `json:"genesis_time"`
+	Period      int64  `json:"period"`
+}
+
+// SetBeaconPublicKey records the channel's drand beacon configuration in the
+// bootstrap collection. Expected to be called once, by channel admins, while
+// setting up AnonThread's tie-breaking.
+func (s *SmartContract) SetBeaconPublicKey(ctx contractapi.TransactionContextInterface, pubKeyHex string, genesisTime int64, period int64) error {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode beacon public key: %v", err)
+	}
+	if len(pubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("beacon public key must be %d bytes", ed25519.PublicKeySize)
+	}
+	if period <= 0 {
+		return fmt.Errorf("period must be positive")
+	}
+
+	bootstrapJSON, err := json.Marshal(beaconBootstrap{PublicKey: pubKey, GenesisTime: genesisTime, Period: period})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutPrivateData(beaconBootstrapCollection, beaconBootstrapKey, bootstrapJSON)
+}
+
+// GetBeaconPublicKey loads the channel's drand beacon configuration from the
+// bootstrap collection.
+func GetBeaconPublicKey(ctx contractapi.TransactionContextInterface) (*beaconBootstrap, error) {
+	data, err := ctx.GetStub().GetPrivateData(beaconBootstrapCollection, beaconBootstrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get beacon bootstrap config: %v", err)
+	}
+	if data == nil {
+		return nil, fmt.Errorf("no drand beacon configured in the bootstrap collection")
+	}
+
+	var bootstrap beaconBootstrap
+	if err := json.Unmarshal(data, &bootstrap); err != nil {
+		return nil, err
+	}
+
+	return &bootstrap, nil
+}
+
+// expectedBeaconRound derives which drand round a given close-block
+// timestamp must fall in, the same way a drand client does from the
+// network's genesis time and period.
+func expectedBeaconRound(bootstrap *beaconBootstrap, unixSeconds int64) uint64 {
+	if unixSeconds <= bootstrap.GenesisTime {
+		return 1
+	}
+	return uint64((unixSeconds-bootstrap.GenesisTime)/bootstrap.Period) + 1
+}
+
+// roundBytes big-endian encodes round, matching drand's own wire encoding of
+// the round number inside the signed message.
+func roundBytes(round uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, round)
+	return b
+}
+
+// verifyAnonBeaconEntry checks entry against the channel's configured drand
+// beacon: it must be strictly newer than any round already recorded on
+// thread, its round must be the one derived from the current close-block
+// timestamp (rejecting stale or premature entries), and its signature must
+// verify.
+func verifyAnonBeaconEntry(ctx contractapi.TransactionContextInterface, thread *AnonThread, entry *BeaconEntry, closeTimestamp int64) error {
+	if entry == nil {
+		return fmt.Errorf("thread is tied between multiple options and requires a beacon entry to break the tie")
+	}
+	if thread.BeaconEntry != nil && entry.Round <= thread.BeaconEntry.Round {
+		return fmt.Errorf("beacon round %d is not newer than the round %d already recorded for this thread", entry.Round, thread.BeaconEntry.Round)
+	}
+
+	bootstrap, err := GetBeaconPublicKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	if want := expectedBeaconRound(bootstrap, closeTimestamp); entry.Round != want {
+		return fmt.Errorf("beacon round %d does not match the round %d derived from the close timestamp", entry.Round, want)
+	}
+
+	return verifyBeaconEntrySignature(bootstrap.PublicKey, entry)
+}
+
+// verifyBeaconEntrySignature checks that entry.Signature is a valid ed25519
+// signature, issued by pubKey, over sha256(entry.PrevSignature ||
+// roundBytes(entry.Round)) - the chained message drand signs in its own
+// randomness chain.
+func verifyBeaconEntrySignature(pubKey []byte, entry *BeaconEntry) error {
+	message := sha256.Sum256(append(append([]byte{}, entry.PrevSignature...), roundBytes(entry.Round)...))
+	if !ed25519.Verify(ed25519.PublicKey(pubKey), message[:], entry.Signature) {
+		return fmt.Errorf("beacon signature does not verify for round %d", entry.Round)
+	}
+	return nil
+}
+
+// pickAnonTiedWinner deterministically derives a single winner from a set of
+// tied option names using a verified beacon entry's signature: every peer
+// hashes (signature || threadID) and picks tied[seed mod n], after sorting
+// tied so the indexing itself is deterministic too.
+func pickAnonTiedWinner(threadID string, signature []byte, tied []string) string {
+	sorted := append([]string(nil), tied...)
+	sort.Strings(sorted)
+
+	seed := sha256.Sum256(append(append([]byte{}, signature...), []byte(threadID)...))
+	index := new(big.Int).Mod(new(big.Int).SetBytes(seed[:]), big.NewInt(int64(len(sorted))))
+
+	return sorted[index.Int64()]
+}
+
+// VerifyThreadRandomness independently re-derives the tie-break winner for
+// threadID from its persisted BeaconEntry and TiedOptions and reports
+// whether it still matches the recorded WinOption, so anyone can confirm the
+// creator did not hand-pick the winner of a tied close.
+func (s *SmartContract) VerifyThreadRandomness(ctx contractapi.TransactionContextInterface, threadID string) (bool, error) {
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get thread from public state %v", err)
+	}
+	if thread.BeaconEntry == nil || len(thread.TiedOptions) == 0 {
+		return false, fmt.Errorf("thread %s did not use beacon-based tie-breaking", threadID)
+	}
+	if len(thread.WinOption) != 1 {
+		return false, fmt.Errorf("thread %s does not have a single recorded winner", threadID)
+	}
+
+	bootstrap, err := GetBeaconPublicKey(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if err := verifyBeaconEntrySignature(bootstrap.PublicKey, thread.BeaconEntry); err != nil {
+		return false, err
+	}
+
+	winner := pickAnonTiedWinner(threadID, thread.BeaconEntry.Signature, thread.TiedOptions)
+	return winner == thread.WinOption[0], nil
+}
@@ -0,0 +1,319 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Тип композитного ключа предложения закрытия голосования.
+const endProposalKeyType = "end_proposal"
+
+// Тип композитного ключа публичной записи об одобрении предложения конкретной организацией.
+const endApprovalKeyType = "end_approval"
+
+// implicitCollectionPrefix is the standard Fabric naming scheme for an
+// org's implicit private data collection, used here to recover an MSP ID
+// from the collection segment of a vote composite key.
+const implicitCollectionPrefix = "_implicit_org_"
+
+// EndProposal records a creator-initiated request to close threadID,
+// committing in advance to the Merkle roots of the private keys and
+// transaction IDs it intends to reveal, so a quorum of participating orgs
+// can approve the close before any vote is actually unmasked - instead of
+// trusting the creator alone not to selectively omit keys. It is stored in
+// the implicit private data collection of every org that participated in
+// the thread (see participatingOrgs); nothing in it is secret, so holding a
+// copy is purely an access-control / audit-trail convenience, not
+// confidentiality.
+type EndProposal struct {
+	ThreadID       string            `json:"thread_id"`
+	KeysMerkleRoot string            `json:"keys_merkle_root"`
+	TxsMerkleRoot  string            `json:"txs_merkle_root"`
+	ProposedAt     int64             `json:"proposed_at"`
+	Approvals      map[string][]byte `json:"approvals"`
+}
+
+func endProposalKey(ctx contractapi.TransactionContextInterface, threadID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(endProposalKeyType, []string{threadID})
+}
+
+func endApprovalKey(ctx contractapi.TransactionContextInterface, threadID string, orgMSP string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(endApprovalKeyType, []string{threadID, orgMSP})
+}
+
+// mspFromCollection recovers the organization MSP ID behind a vote's
+// implicit private data collection name - the inverse of whatever
+// getCollectionName derives for the calling org.
+func mspFromCollection(collection string) (string, error) {
+	if !strings.HasPrefix(collection, implicitCollectionPrefix) {
+		return "", fmt.Errorf("unexpected implicit collection name %q", collection)
+	}
+	return strings.TrimPrefix(collection, implicitCollectionPrefix), nil
+}
+
+// participatingOrgs returns the distinct MSP IDs (N in the ceil(2N/3) quorum
+// that endProposalApproved checks for EndAnonThread) recovered from the
+// collection segment of every vote composite key stored for threadID. Those
+// keys are written by CreateVote and marked spent by UseAnonVote; every
+// stored key is counted, spent or not. A thread with no vote keys at all
+// (e.g. one run only through the commit-reveal flow, see
+// AnonThread.UsesCommitReveal) still has to pass through the same
+// propose/approve gate before EndAnonThread will close it, so it falls back
+// to requiring just the creator's own org.
+func participatingOrgs(ctx contractapi.TransactionContextInterface, threadID string) ([]string, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(voteKeyType, []string{threadID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query votes: %v", err)
+	}
+	defer iterator.Close()
+
+	seen := make(map[string]bool)
+	orgs := make([]string, 0)
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, parts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) < 3 {
+			continue
+		}
+
+		mspID, err := mspFromCollection(parts[2])
+		if err != nil {
+			continue
+		}
+		if !seen[mspID] {
+			seen[mspID] = true
+			orgs = append(orgs, mspID)
+		}
+	}
+
+	if len(orgs) == 0 {
+		threadJSON, err := ctx.GetStub().GetState(threadID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get thread object %v: %v", threadID, err)
+		}
+		if threadJSON == nil {
+			return nil, fmt.Errorf("thread does not exist")
+		}
+
+		var thread AnonThread
+		if err := json.Unmarshal(threadJSON, &thread); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, thread.CreatorMSP)
+	}
+
+	return orgs, nil
+}
+
+// quorumSize returns ceil(2N/3): the number of distinct participating orgs
+// that must approve an EndProposal before EndAnonThread may act on it.
+func quorumSize(n int) int {
+	return int(math.Ceil(2 * float64(n) / 3))
+}
+
+// ProposeEndAnonThread opens the two-phase close for threadID: it commits
+// to the Merkle roots of the keys and transaction IDs the creator intends
+// to reveal via the existing EndAnonThread/EndData flow, grants every
+// participating org peer-endorsement rights over the thread (so the
+// creator's single org can no longer unilaterally endorse a close), and
+// stores the proposal in each participating org's implicit collection.
+func (s *SmartContract) ProposeEndAnonThread(ctx contractapi.TransactionContextInterface, threadID string, keysMerkleRoot string, txsMerkleRoot string) error {
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread from public state %v", err)
+	}
+	if thread.Status != "open" {
+		return fmt.Errorf("cannot propose closing a thread that is not open")
+	}
+
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+	if thread.Creator != clientID {
+		return fmt.Errorf("thread can only be proposed closed by its creator")
+	}
+
+	orgs, err := participatingOrgs(ctx, threadID)
+	if err != nil {
+		return err
+	}
+
+	if err := setAssetStateBasedEndorsement(ctx, threadID, orgs...); err != nil {
+		return fmt.Errorf("failed setting state based endorsement for participating organizations: %v", err)
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+
+	proposal := EndProposal{
+		ThreadID:       threadID,
+		KeysMerkleRoot: keysMerkleRoot,
+		TxsMerkleRoot:  txsMerkleRoot,
+		ProposedAt:     txTimestamp.Seconds,
+		Approvals:      make(map[string][]byte),
+	}
+
+	proposalJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return err
+	}
+
+	key, err := endProposalKey(ctx, threadID)
+	if err != nil {
+		return err
+	}
+
+	for _, orgMSP := range orgs {
+		collection := implicitCollectionPrefix + orgMSP
+		if err := ctx.GetStub().PutPrivateData(collection, key, proposalJSON); err != nil {
+			return fmt.Errorf("failed to store end proposal for org %s: %v", orgMSP, err)
+		}
+	}
+
+	return nil
+}
+
+// ApproveEndAnonThread lets the caller's org sign off on threadID's pending
+// EndProposal. It verifies the caller's own implicit collection holds a
+// copy of the proposal (i.e. their org is one setAssetStateBasedEndorsement
+// granted endorsement rights to in ProposeEndAnonThread), records sigHex
+// in that private copy for audit, and publishes a public marker so
+// EndAnonThread can count approvals across orgs without reading private
+// data it has no access to. sigHex itself is not verified against an
+// on-chain key registry (unlike the ed25519 beacon sources in beacon.go) -
+// Fabric's own endorsement signs the transaction that calls this method, so
+// sigHex is kept as a portable attestation for off-chain audit rather than
+// an additional on-chain authentication check.
+func (s *SmartContract) ApproveEndAnonThread(ctx contractapi.TransactionContextInterface, threadID string, sigHex string) error {
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	key, err := endProposalKey(ctx, threadID)
+	if err != nil {
+		return err
+	}
+
+	proposalData, err := ctx.GetStub().GetPrivateData(collection, key)
+	if err != nil {
+		return fmt.Errorf("failed to get end proposal: %v", err)
+	}
+	if proposalData == nil {
+		return fmt.Errorf("organization %s is not a party to any pending close proposal for thread %s", clientOrgID, threadID)
+	}
+
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode approval signature: %v", err)
+	}
+
+	var proposal EndProposal
+	if err := json.Unmarshal(proposalData, &proposal); err != nil {
+		return err
+	}
+	if proposal.Approvals == nil {
+		proposal.Approvals = make(map[string][]byte)
+	}
+	proposal.Approvals[clientOrgID] = sig
+
+	proposalJSON, err := json.Marshal(proposal)
+	if err != nil {
+		return err
+	}
+	if err := ctx.GetStub().PutPrivateData(collection, key, proposalJSON); err != nil {
+		return fmt.Errorf("failed to record approval: %v", err)
+	}
+
+	approvalKey, err := endApprovalKey(ctx, threadID, clientOrgID)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(approvalKey, sig)
+}
+
+// endProposalApproved reports whether threadID's EndProposal has collected
+// approvals from at least ceil(2N/3) of the orgs that participated in the
+// thread, and returns the proposal itself so its committed Merkle roots can
+// be checked against the votes actually being revealed. ProposeEndAnonThread
+// only stores a copy in the collections of participating orgs, which does
+// not necessarily include the creator's own org (a creator can run a poll
+// without voting in it), so the proposal is read from whichever
+// participating org's collection is reachable instead of assuming the
+// caller's own.
+func endProposalApproved(ctx contractapi.TransactionContextInterface, threadID string) (*EndProposal, error) {
+	orgs, err := participatingOrgs(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	approvals := 0
+	for _, orgMSP := range orgs {
+		approvalKey, err := endApprovalKey(ctx, threadID, orgMSP)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ctx.GetStub().GetState(approvalKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get approval: %v", err)
+		}
+		if data != nil {
+			approvals++
+		}
+	}
+
+	if approvals < quorumSize(len(orgs)) {
+		return nil, fmt.Errorf("end proposal for thread %s has %d of the required %d org approvals", threadID, approvals, quorumSize(len(orgs)))
+	}
+
+	key, err := endProposalKey(ctx, threadID)
+	if err != nil {
+		return nil, err
+	}
+
+	var proposalData []byte
+	for _, orgMSP := range orgs {
+		data, err := ctx.GetStub().GetPrivateData(implicitCollectionPrefix+orgMSP, key)
+		if err != nil || data == nil {
+			continue
+		}
+		proposalData = data
+		break
+	}
+	if proposalData == nil {
+		return nil, fmt.Errorf("no end proposal found for thread %s in any participating org's collection", threadID)
+	}
+
+	var proposal EndProposal
+	if err := json.Unmarshal(proposalData, &proposal); err != nil {
+		return nil, err
+	}
+
+	return &proposal, nil
+}
@@ -0,0 +1,210 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// anonMode and delegatedMode are the two values AnonThread.Mode may take:
+// anonMode is the original one vote-per-identity poll, delegatedMode layers
+// DPOS-style weighted delegation on top, modelled on the stakeholder ->
+// validator delegation used by Bytom/Vapor's consensus.
+const (
+	anonMode      = "anon"
+	delegatedMode = "delegated"
+)
+
+// maxAnonDelegationChainDepth bounds how far DelegateAnonVote walks an
+// existing delegation chain when checking for cycles, mirroring
+// maxDelegationChainDepth in delegation.go.
+const maxAnonDelegationChainDepth = 5
+
+// WeightResolver resolves the base voting weight of an enrollment ID at the
+// moment it delegates. The default resolver gives every enrollment a weight
+// of 1; an organization can install its own resolver (e.g. backed by a
+// token balance or stake) via SetWeightResolver.
+type WeightResolver interface {
+	BaseWeight(ctx contractapi.TransactionContextInterface, userID string) (uint64, error)
+}
+
+// defaultWeightResolver gives every enrollment a flat weight of 1, so each
+// DelegateAnonVote adds exactly one to its delegate's Weights entry. A cast
+// vote is tallied by its caster's Weights entry alone (see EndAnonThread), so
+// a caster nobody has delegated to is tallied at zero.
+type defaultWeightResolver struct{}
+
+func (defaultWeightResolver) BaseWeight(ctx contractapi.TransactionContextInterface, userID string) (uint64, error) {
+	return 1, nil
+}
+
+// activeWeightResolver is consulted by DelegateAnonVote. Deployments that
+// want weight derived from a token balance or stake should call
+// SetWeightResolver during chaincode init.
+var activeWeightResolver WeightResolver = defaultWeightResolver{}
+
+// SetWeightResolver installs the WeightResolver used by every subsequent
+// DelegateAnonVote call.
+func SetWeightResolver(r WeightResolver) {
+	activeWeightResolver = r
+}
+
+// optionTotal sums an option's recorded ballots: in delegatedMode, each
+// entry is the caster's weight at tally time, encoded as a decimal string;
+// in every other mode a ballot is worth exactly one, regardless of its
+// recorded value.
+func optionTotal(votes []string, mode string) (uint64, error) {
+	if mode != delegatedMode {
+		return uint64(len(votes)), nil
+	}
+
+	var total uint64
+	for _, v := range votes {
+		weight, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse recorded vote weight %q: %v", v, err)
+		}
+		total += weight
+	}
+
+	return total, nil
+}
+
+// DelegateAnonVote lets the caller forward their base voting weight (from
+// the installed WeightResolver) to delegateID on a delegatedMode thread, DPOS
+// style: delegateID's entry in Weights grows by the caller's weight, and the
+// caller is barred from casting their own vote (see UseAnonVote) until they
+// call RevokeAnonDelegation. A bounded walk of the existing delegation chain
+// rejects cycles.
+func (s *SmartContract) DelegateAnonVote(ctx contractapi.TransactionContextInterface, threadID string, delegateID string) error {
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread from public state %v", err)
+	}
+	if thread.Mode != delegatedMode {
+		return fmt.Errorf("thread %s is not in delegated mode", threadID)
+	}
+	if thread.Status != "open" {
+		return fmt.Errorf("cannot delegate a vote on a thread that is not open")
+	}
+
+	callerID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return err
+	}
+	if callerID == delegateID {
+		return fmt.Errorf("cannot delegate a vote to yourself")
+	}
+	if thread.Delegations[callerID] != "" {
+		return fmt.Errorf("enrollment %s has already delegated their vote on thread %s", callerID, threadID)
+	}
+
+	// Запрещаем циклы делегирования, проходя по существующей цепочке на ограниченную глубину.
+	current := delegateID
+	for depth := 0; depth < maxAnonDelegationChainDepth; depth++ {
+		next, ok := thread.Delegations[current]
+		if !ok || next == "" {
+			break
+		}
+		if next == callerID {
+			return fmt.Errorf("delegating to %s would create a delegation cycle", delegateID)
+		}
+		current = next
+	}
+
+	weight, err := activeWeightResolver.BaseWeight(ctx, callerID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve base weight: %v", err)
+	}
+
+	thread.Delegations[callerID] = delegateID
+	thread.Weights[delegateID] += weight
+
+	threadJSON, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(threadID, threadJSON); err != nil {
+		return fmt.Errorf("failed to update thread: %v", err)
+	}
+
+	eventPayload, err := json.Marshal(map[string]string{
+		"thread_id": threadID,
+		"delegator": callerID,
+		"delegate":  delegateID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().SetEvent(fmt.Sprintf("DelegateVote %s", threadID), eventPayload); err != nil {
+		return fmt.Errorf("failed to set event of delegating vote: %v", err)
+	}
+
+	return nil
+}
+
+// RevokeAnonDelegation cancels a previously created DelegateAnonVote,
+// subtracting the caller's weight back out of their delegate's entry.
+func (s *SmartContract) RevokeAnonDelegation(ctx contractapi.TransactionContextInterface, threadID string) error {
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread from public state %v", err)
+	}
+	if thread.Mode != delegatedMode {
+		return fmt.Errorf("thread %s is not in delegated mode", threadID)
+	}
+
+	callerID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return err
+	}
+
+	delegateID, ok := thread.Delegations[callerID]
+	if !ok || delegateID == "" {
+		return fmt.Errorf("no delegation to revoke for thread %s", threadID)
+	}
+
+	weight, err := activeWeightResolver.BaseWeight(ctx, callerID)
+	if err != nil {
+		return fmt.Errorf("failed to resolve base weight: %v", err)
+	}
+
+	if weight >= thread.Weights[delegateID] {
+		delete(thread.Weights, delegateID)
+	} else {
+		thread.Weights[delegateID] -= weight
+	}
+	delete(thread.Delegations, callerID)
+
+	threadJSON, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(threadID, threadJSON); err != nil {
+		return fmt.Errorf("failed to update thread: %v", err)
+	}
+
+	eventPayload, err := json.Marshal(map[string]string{
+		"thread_id": threadID,
+		"delegator": callerID,
+		"delegate":  delegateID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().SetEvent(fmt.Sprintf("RevokeDelegation %s", threadID), eventPayload); err != nil {
+		return fmt.Errorf("failed to set event of revoking delegation: %v", err)
+	}
+
+	return nil
+}
@@ -2,30 +2,80 @@ package auction
 
 import (
 	"crypto/sha256"
-	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strconv"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// Тип композитного ключа коммита анонимного голоса в приватной коллекции.
+const commitKeyType = "commitment"
+
+// Тип композитного ключа, хранящего хэш листа голоса в Merkle-дереве,
+// по которому голосующий впоследствии может запросить доказательство включения.
+const voteIndexKeyType = "vote_index"
+
 // Сущность анонимного голосования
 type AnonThread struct {
 	Category    string              `json:"category"`
 	Theme       string              `json:"theme"`
 	Description string              `json:"description"`
 	Creator     string              `json:"creator"`
+	CreatorMSP  string              `json:"creator_msp"`
 	Votes       []string            `json:"votes"`
 	Options     map[string][]string `json:"options"`
 	WinOption   []string            `json:"win_option"`
 	Status      string              `json:"status"`
+	// Disqualified marks hf.EnrollmentIDs caught equivocating on this thread
+	// (see SubmitAnonVoteEvidence in evidence.go). The org-wide ban enforced
+	// by isDisqualified is tracked separately, keyed by CreatorMSP; this map
+	// is kept alongside it as a per-thread record of who was struck here.
+	Disqualified map[string]bool `json:"disqualified"`
+	// MerkleRoot, Spine и LeafCount описывают инкрементальное Merkle-дерево
+	// над Votes (см. merkle.go): Spine хранит крайние правые хэши по
+	// уровням, что позволяет добавлять голос и пересчитывать корень за
+	// O(log n) вместо повторного хэширования всех голосов.
+	MerkleRoot string   `json:"merkle_root"`
+	Spine      []string `json:"spine"`
+	LeafCount  uint64   `json:"leaf_count"`
+	// UsesCommitReveal selects which of EndAnonThread's two close paths
+	// applies to this thread: true routes through the commit-reveal path
+	// (CommitVote/RevealVote, tallied as RevealVote is called), false
+	// through the UseAnonVote/Merkle-batch-reveal path (tallied from
+	// EndData.Votes). Both paths are gated by the multi-org quorum in
+	// anonClose.go. Set once at creation from whether
+	// CommitDeadline/RevealDeadline were given.
+	UsesCommitReveal bool `json:"uses_commit_reveal"`
+	// CommitDeadline и RevealDeadline заданы (не равны нулю) только когда
+	// UsesCommitReveal: CommitVote принимается до CommitDeadline, RevealVote
+	// - между CommitDeadline и RevealDeadline, а EndAnonThread отказывается
+	// закрывать голосование до RevealDeadline.
+	CommitDeadline int64 `json:"commit_deadline"`
+	RevealDeadline int64 `json:"reveal_deadline"`
+	// Mode selects the voting scheme: anonMode (default) is a plain one
+	// vote-per-identity poll, delegatedMode layers DPOS-style weighted
+	// delegation on top (see anonDelegation.go) - Weights and Delegations
+	// are only populated in delegatedMode.
+	Mode        string            `json:"mode"`
+	Weights     map[string]uint64 `json:"weights,omitempty"`
+	Delegations map[string]string `json:"delegations,omitempty"`
+	// BeaconEntry and TiedOptions record the drand-style randomness used to
+	// break a tie in EndAnonThread (see anonBeacon.go), so anyone re-reading
+	// the thread can independently confirm WinOption via
+	// VerifyThreadRandomness instead of trusting the creator's pick. Both are
+	// nil/empty when the thread closed without a tie.
+	BeaconEntry *BeaconEntry `json:"beacon_entry,omitempty"`
+	TiedOptions []string     `json:"tied_options,omitempty"`
 }
 
 // Создает анонимное голосование.
 func (s *SmartContract) CreateAnonThread(ctx contractapi.TransactionContextInterface) error {
 	// Получаем параметры из аргументов.
 	args := ctx.GetStub().GetStringArgs()
-	if len(args) < 4 {
+	if len(args) < 9 {
 		return fmt.Errorf("not enough arguments")
 	}
 
@@ -33,7 +83,32 @@ func (s *SmartContract) CreateAnonThread(ctx contractapi.TransactionContextInter
 	category := args[2]
 	theme := args[3]
 	description := args[4]
-	options := args[5:]
+
+	// commitDeadline/revealDeadline both 0 opts the thread out of the
+	// commit-reveal path entirely, routing it through UseAnonVote's
+	// Merkle-batch-reveal path in EndAnonThread instead (see
+	// AnonThread.UsesCommitReveal).
+	commitDeadline, err := strconv.ParseInt(args[5], 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse commit deadline: %v", err)
+	}
+
+	revealDeadline, err := strconv.ParseInt(args[6], 10, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse reveal deadline: %v", err)
+	}
+
+	usesCommitReveal := commitDeadline != 0 || revealDeadline != 0
+	if usesCommitReveal && revealDeadline <= commitDeadline {
+		return fmt.Errorf("reveal deadline must be after commit deadline")
+	}
+
+	mode := args[7]
+	if mode != anonMode && mode != delegatedMode {
+		return fmt.Errorf("mode must be %q or %q", anonMode, delegatedMode)
+	}
+
+	options := args[8:]
 
 	// Запрашиваем голосование по ID из блокчейна, тем самым проверяем, не существует ли уже голосвание с данным ID.
 	res, err := ctx.GetStub().GetState(threadID)
@@ -63,14 +138,25 @@ func (s *SmartContract) CreateAnonThread(ctx contractapi.TransactionContextInter
 	}
 
 	tread := AnonThread{
-		Category:    category,
-		Theme:       theme,
-		Description: description,
-		Creator:     clientID,
-		Votes:       []string{},
-		Options:     threadOptions,
-		WinOption:   []string{},
-		Status:      "open",
+		Category:         category,
+		Theme:            theme,
+		Description:      description,
+		Creator:          clientID,
+		CreatorMSP:       clientOrgID,
+		Votes:            []string{},
+		Options:          threadOptions,
+		WinOption:        []string{},
+		Status:           "open",
+		UsesCommitReveal: usesCommitReveal,
+		CommitDeadline:   commitDeadline,
+		RevealDeadline:   revealDeadline,
+		Disqualified:     make(map[string]bool),
+		Mode:             mode,
+	}
+
+	if mode == delegatedMode {
+		tread.Weights = make(map[string]uint64)
+		tread.Delegations = make(map[string]string)
 	}
 
 	threadJSON, err := json.Marshal(tread)
@@ -90,8 +176,15 @@ func (s *SmartContract) CreateAnonThread(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
 	}
 
-	// Отправляем ивент о создании голосования.
-	err = ctx.GetStub().SetEvent(fmt.Sprintf("CreateAnonThread %s", threadID), threadJSON)
+	// Отправляем типизированный ивент о создании голосования.
+	err = emitTypedEvent(ctx, AnonThreadCreated{
+		ThreadID:    threadID,
+		Category:    category,
+		CreatorMSP:  clientOrgID,
+		Theme:       theme,
+		Description: description,
+		Mode:        mode,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to set event of creating thread: %v", err)
 	}
@@ -99,11 +192,173 @@ func (s *SmartContract) CreateAnonThread(ctx contractapi.TransactionContextInter
 	return nil
 }
 
+// CommitVote accepts a vote commitment commitmentHex = H(optionID || nonce
+// || userSecret), computed off-chain by the voter, and stores it in the
+// implicit private-data collection of the voter's organization, keyed by
+// hf.EnrollmentID so a single identity cannot commit twice. The commitment
+// itself never touches the public ledger - only RevealVote's outcome does.
+func (s *SmartContract) CommitVote(ctx contractapi.TransactionContextInterface, threadID string, commitmentHex string) error {
+
+	// Получаем сущность голосования из блокчейна.
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread from public state %v", err)
+	}
+
+	if thread.Status != "open" {
+		return fmt.Errorf("cannot commit to a closed thread")
+	}
+
+	// Проверяем, что окно коммитов еще открыто.
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	if txTimestamp.Seconds >= thread.CommitDeadline {
+		return fmt.Errorf("commit window for thread %s has closed", threadID)
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	userID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return err
+	}
+
+	disqualified, err := isDisqualified(ctx, thread.CreatorMSP, userID)
+	if err != nil {
+		return err
+	}
+	if disqualified {
+		return fmt.Errorf("enrollment %s is disqualified for equivocation and cannot commit further votes", userID)
+	}
+
+	commitKey, err := ctx.GetStub().CreateCompositeKey(commitKeyType, []string{threadID, userID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// Не допускаем двойной коммит одной и той же личности.
+	existing, err := ctx.GetStub().GetPrivateData(collection, commitKey)
+	if err != nil {
+		return fmt.Errorf("failed to check existing commitment: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("enrollment %s has already committed a vote for thread %s", userID, threadID)
+	}
+
+	err = ctx.GetStub().PutPrivateData(collection, commitKey, []byte(commitmentHex))
+	if err != nil {
+		return fmt.Errorf("failed to store commitment: %v", err)
+	}
+
+	return nil
+}
+
+// commitmentHash computes H(optionID || nonce || userSecret), the same hex
+// sha256 digest a voter commits via CommitVote and RevealVote later opens.
+func commitmentHash(optionID string, nonceHex string, userSecret string) string {
+	hash := sha256.Sum256([]byte(optionID + nonceHex + userSecret))
+	return hex.EncodeToString(hash[:])
+}
+
+// RevealVote opens a previously submitted commitment by recomputing
+// H(optionID || nonce || userSecret) and comparing it against the stored
+// commitment. userSecret is the caller's hf.EnrollmentID; neither CommitVote
+// nor RevealVote writes it or the commitment to public state, so the public
+// tally never binds an option back to a voter's identity.
+func (s *SmartContract) RevealVote(ctx contractapi.TransactionContextInterface, threadID string, optionID string, nonceHex string) error {
+
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread from public state %v", err)
+	}
+
+	if thread.Status != "open" {
+		return fmt.Errorf("cannot reveal a vote on a closed thread")
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	if txTimestamp.Seconds < thread.CommitDeadline {
+		return fmt.Errorf("commit window for thread %s is still open", threadID)
+	}
+	if txTimestamp.Seconds >= thread.RevealDeadline {
+		return fmt.Errorf("reveal window for thread %s has closed", threadID)
+	}
+
+	if !contains(thread.Options, optionID) {
+		return fmt.Errorf("failed to reveal vote: unexpected option")
+	}
+
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	userID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return err
+	}
+
+	commitKey, err := ctx.GetStub().CreateCompositeKey(commitKeyType, []string{threadID, userID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	storedCommitment, err := ctx.GetStub().GetPrivateData(collection, commitKey)
+	if err != nil {
+		return fmt.Errorf("failed to get commitment: %v", err)
+	}
+	if storedCommitment == nil {
+		return fmt.Errorf("no commitment found for this identity on thread %s", threadID)
+	}
+
+	if commitmentHash(optionID, nonceHex, userID) != string(storedCommitment) {
+		return fmt.Errorf("revealed option/nonce does not match the stored commitment")
+	}
+
+	// Коммит раскрыт, удаляем его из приватной коллекции, чтобы исключить повторное раскрытие.
+	err = ctx.GetStub().DelPrivateData(collection, commitKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete spent commitment: %v", err)
+	}
+
+	thread.Options[optionID] = append(thread.Options[optionID], "vote")
+
+	threadJSON, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().PutState(threadID, threadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to update thread: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(fmt.Sprintf("RevealVote %s", threadID), threadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event of revealing vote: %v", err)
+	}
+
+	return nil
+}
+
 type AnonVote struct {
 	ThreadID   string `json:"thread_id"`
 	TxID       string `json:"tx_id"`
 	Option     string `json:"option"`
 	PrivateKey string `json:"private_key"`
+	// Voter is only required in delegatedMode, where weighted tallying needs
+	// to know whose Weights entry to credit, trading anonymity for
+	// accountable vote weight as in delegated-staking (DPOS) schemes. It is
+	// ignored in anonMode, where votes stay unattributed.
+	Voter string `json:"voter,omitempty"`
 }
 
 // Принимает анонимный голос и добавляет хэш этого голоса к сущности.
@@ -150,6 +405,23 @@ func (s *SmartContract) UseAnonVote(ctx contractapi.TransactionContextInterface)
 		return err
 	}
 
+	disqualified, err := isDisqualified(ctx, tread.CreatorMSP, userID)
+	if err != nil {
+		return err
+	}
+	if disqualified {
+		return fmt.Errorf("enrollment %s is disqualified for equivocation and cannot cast further votes", userID)
+	}
+
+	if tread.Mode == delegatedMode {
+		if vote.Voter != userID {
+			return fmt.Errorf("delegated mode requires the vote's voter to match the caller's enrollment")
+		}
+		if tread.Delegations[userID] != "" {
+			return fmt.Errorf("enrollment %s has delegated their vote and cannot cast it directly", userID)
+		}
+	}
+
 	// Создаем композитный ключ для поиска голоса в блокчейне.
 	voteKey, err := ctx.GetStub().CreateCompositeKey(voteKeyType, []string{vote.ThreadID, vote.TxID, collection, userID})
 	if err != nil {
@@ -172,12 +444,12 @@ func (s *SmartContract) UseAnonVote(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("failed to use vote: unexpected option")
 	}
 
-	hash := sha256.New()
-	hash.Write(transientOptionJSON)
-	calculatedVoteJSONHash := base64.URLEncoding.EncodeToString(hash.Sum(nil))
-
-	// Добавляем голос к выбранному варианту
-	tread.Votes = append(tread.Votes, calculatedVoteJSONHash)
+	// Добавляем голос как очередной лист инкрементального Merkle-дерева за O(log n).
+	leafHash, err := appendMerkleLeaf(tread, transientOptionJSON)
+	if err != nil {
+		return fmt.Errorf("failed to append vote to merkle tree: %v", err)
+	}
+	tread.Votes = append(tread.Votes, leafHash)
 
 	// Переводим в джсон обновленный тред
 	newThreadJSON, err := json.Marshal(tread)
@@ -197,8 +469,27 @@ func (s *SmartContract) UseAnonVote(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("failed to update auction: %v", err)
 	}
 
-	// Записываем ивент о использовании голоса.
-	err = ctx.GetStub().SetEvent(fmt.Sprintf("UseAnonVote %s", vote.ThreadID), newThreadJSON)
+	// Запоминаем хэш листа (а не его позицию) под ключом самого голосующего,
+	// чтобы позже он сам мог запросить доказательство включения своего
+	// голоса: SubmitAnonVoteEvidence может сдвинуть позиции выживших листьев
+	// при пересборке дерева (см. rebuildMerkleTree), а хэш остается тем же.
+	voteIndexKey, err := ctx.GetStub().CreateCompositeKey(voteIndexKeyType, []string{vote.ThreadID, vote.TxID, collection, userID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(voteIndexKey, []byte(leafHash))
+	if err != nil {
+		return fmt.Errorf("failed to store vote leaf hash: %v", err)
+	}
+
+	// Записываем типизированный ивент о использовании голоса.
+	err = emitTypedEvent(ctx, AnonVoteCast{
+		ThreadID:   vote.ThreadID,
+		Category:   tread.Category,
+		CreatorMSP: tread.CreatorMSP,
+		Option:     vote.Option,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to set event of using vote: %v", err)
 	}
@@ -206,10 +497,123 @@ func (s *SmartContract) UseAnonVote(ctx contractapi.TransactionContextInterface)
 	return nil
 }
 
+// MerkleProof is an audit path proving that LeafHash sits at Index in the
+// thread's Merkle tree, verifiable against the thread's stored MerkleRoot.
+type MerkleProof struct {
+	LeafHash string   `json:"leaf_hash"`
+	Index    uint64   `json:"index"`
+	Path     []string `json:"path"`
+}
+
+// ProveAnonVote returns the Merkle audit path for the caller's own vote on
+// threadID, identified by the txID that CreateVote returned for the vote they
+// later spent via UseAnonVote, so they can verify their vote's inclusion
+// without downloading the whole thread.
+func (s *SmartContract) ProveAnonVote(ctx contractapi.TransactionContextInterface, threadID string, txID string) (*MerkleProof, error) {
+	collection, err := getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get implicit collection name: %v", err)
+	}
+
+	userID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return nil, err
+	}
+
+	voteIndexKey, err := ctx.GetStub().CreateCompositeKey(voteIndexKeyType, []string{threadID, txID, collection, userID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	leafHashData, err := ctx.GetStub().GetState(voteIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get vote leaf hash: %v", err)
+	}
+	if leafHashData == nil {
+		return nil, fmt.Errorf("no committed vote found for this identity and transaction")
+	}
+	leafHashHex := string(leafHashData)
+
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread from public state %v", err)
+	}
+
+	// Позиция листа могла сдвинуться с момента голосования, если
+	// SubmitAnonVoteEvidence пересобрала дерево без чужих голосов, поэтому
+	// ищем текущую позицию по самому хэшу, а не по ранее сохраненному индексу.
+	index := -1
+	for i, leafHex := range thread.Votes {
+		if leafHex == leafHashHex {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("vote for this identity and transaction is no longer part of thread %s (possibly struck as equivocation evidence)", threadID)
+	}
+
+	leaves := make([][]byte, len(thread.Votes))
+	for i, leafHex := range thread.Votes {
+		leaf, err := hex.DecodeString(leafHex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode stored leaf hash: %v", err)
+		}
+		leaves[i] = leaf
+	}
+
+	path, err := buildMerkleProof(leaves, index)
+	if err != nil {
+		return nil, err
+	}
+
+	pathHex := make([]string, len(path))
+	for i, sibling := range path {
+		pathHex[i] = hex.EncodeToString(sibling)
+	}
+
+	return &MerkleProof{LeafHash: thread.Votes[index], Index: uint64(index), Path: pathHex}, nil
+}
+
+// VerifyAnonVoteProof verifies, purely against the thread's stored
+// MerkleRoot, that leafHashHex sits at index per path.
+func (s *SmartContract) VerifyAnonVoteProof(ctx contractapi.TransactionContextInterface, threadID string, leafHashHex string, path []string, index uint64) (bool, error) {
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get thread from public state %v", err)
+	}
+
+	leaf, err := hex.DecodeString(leafHashHex)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode leaf hash: %v", err)
+	}
+
+	root, err := hex.DecodeString(thread.MerkleRoot)
+	if err != nil {
+		return false, fmt.Errorf("failed to decode stored merkle root: %v", err)
+	}
+
+	decodedPath := make([][]byte, len(path))
+	for i, siblingHex := range path {
+		sibling, err := hex.DecodeString(siblingHex)
+		if err != nil {
+			return false, fmt.Errorf("failed to decode proof sibling: %v", err)
+		}
+		decodedPath[i] = sibling
+	}
+
+	return verifyMerkleProof(leaf, index, decodedPath, root), nil
+}
+
 type EndData struct {
-	ThreadID string   `json:"thread_id"`
-	Keys     []string `json:"keys"`
-	VoteTxs  []string `json:"vote_txs"`
+	ThreadID string `json:"thread_id"`
+	// Votes must be in the exact order the matching UseAnonVote calls were
+	// submitted in, so re-hashing them reproduces thread.MerkleRoot in one
+	// pass instead of matching every stored hash against every candidate.
+	Votes []AnonVote `json:"votes"`
+	// BeaconEntry is only required when the close turns out to be tied
+	// between more than one option (see anonBeacon.go).
+	BeaconEntry *BeaconEntry `json:"beacon_entry,omitempty"`
 }
 
 // Завершает голосование, расшифровывает голоса и определяет выйгрышный вариант/варианты.
@@ -257,46 +661,137 @@ func (s *SmartContract) EndAnonThread(ctx contractapi.TransactionContextInterfac
 
 	thread.Status = string("closed")
 
-	// Разгадываем хэшт голосов и распределяем варианты.
-	for _, vote := range thread.Votes {
-		for _, tx := range endData.VoteTxs {
-			for _, key := range endData.Keys {
-				for option := range thread.Options {
-					anonVote := &AnonVote{
-						ThreadID:   endData.ThreadID,
-						TxID:       tx,
-						Option:     option,
-						PrivateKey: key,
-					}
-
-					b, _ := json.Marshal(anonVote)
-
-					hash := sha256.New()
-					hash.Write(b)
-					calculatedVoteJSONHash := base64.URLEncoding.EncodeToString(hash.Sum(nil))
-
-					if calculatedVoteJSONHash == vote {
-						thread.Options[option] = append(thread.Options[option], "vote")
-					}
+	// Для многоорганизационного кворума обоим путям закрытия требуется
+	// предложение о закрытии, одобренное как минимум ceil(2N/3)
+	// организаций-участников (см. anonClose.go) - иначе закрыть голосование
+	// мог бы один создатель единолично.
+	proposal, err := endProposalApproved(ctx, endData.ThreadID)
+	if err != nil {
+		return fmt.Errorf("end proposal not approved by quorum: %v", err)
+	}
+
+	if thread.UsesCommitReveal {
+		// Голосование проводится в commit-reveal режиме: закрывать его можно
+		// только после окончания окна раскрытия, а тальи уже накоплены в
+		// thread.Options по мере вызовов RevealVote.
+		txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+		if err != nil {
+			return fmt.Errorf("failed to get tx timestamp: %v", err)
+		}
+		if txTimestamp.Seconds < thread.RevealDeadline {
+			return fmt.Errorf("cannot close thread %s before its reveal window closes", endData.ThreadID)
+		}
+	} else {
+		// Обычный режим: голосующий присылает голоса в том же порядке, в
+		// котором они были закоммичены UseAnonVote, и мы пересчитываем
+		// дерево за один проход, вместо перебора votes x txs x keys x options.
+		if uint64(len(endData.Votes)) != thread.LeafCount {
+			return fmt.Errorf("expected %d votes to close thread %s, got %d", thread.LeafCount, endData.ThreadID, len(endData.Votes))
+		}
+
+		leaves := make([][]byte, len(endData.Votes))
+		for i, anonVote := range endData.Votes {
+			b, err := json.Marshal(anonVote)
+			if err != nil {
+				return err
+			}
+			leaves[i] = merkleLeafHash(b)
+
+			if hex.EncodeToString(leaves[i]) != thread.Votes[i] {
+				return fmt.Errorf("submitted vote at index %d does not match the committed leaf", i)
+			}
+		}
+
+		spine := make([][]byte, merkleTreeDepth)
+		node := make([]byte, 0)
+		size := uint64(0)
+		for _, leaf := range leaves {
+			node = leaf
+			size++
+			pos := size
+			for height := 0; height < merkleTreeDepth; height++ {
+				if pos&1 == 1 {
+					spine[height] = node
+					break
 				}
+				node = merkleNodeHash(spine[height], node)
+				pos >>= 1
+			}
+		}
+
+		recomputedRoot := hex.EncodeToString(merkleRootFromSpine(spine, thread.LeafCount))
+		if recomputedRoot != thread.MerkleRoot {
+			return fmt.Errorf("recomputed merkle root does not match the stored root for thread %s", endData.ThreadID)
+		}
+
+		// Сверяем закоммиченные в предложении корни с теми ключами и TxID,
+		// что раскрываются сейчас, иначе создатель мог бы выборочно
+		// умолчать о части ключей после того, как кворум уже одобрил
+		// предложение.
+		keyLeaves := make([][]byte, len(endData.Votes))
+		txLeaves := make([][]byte, len(endData.Votes))
+		for i, anonVote := range endData.Votes {
+			keyLeaves[i] = merkleLeafHash([]byte(anonVote.PrivateKey))
+			txLeaves[i] = merkleLeafHash([]byte(anonVote.TxID))
+		}
+
+		keysMerkleRoot := hex.EncodeToString(staticMerkleRoot(keyLeaves))
+		txsMerkleRoot := hex.EncodeToString(staticMerkleRoot(txLeaves))
+		if keysMerkleRoot != proposal.KeysMerkleRoot {
+			return fmt.Errorf("revealed keys do not match the approved end proposal for thread %s", endData.ThreadID)
+		}
+		if txsMerkleRoot != proposal.TxsMerkleRoot {
+			return fmt.Errorf("revealed transactions do not match the approved end proposal for thread %s", endData.ThreadID)
+		}
+
+		for _, anonVote := range endData.Votes {
+			entry := "vote"
+			if thread.Mode == delegatedMode {
+				entry = strconv.FormatUint(thread.Weights[anonVote.Voter], 10)
 			}
+			thread.Options[anonVote.Option] = append(thread.Options[anonVote.Option], entry)
 		}
 	}
 
 	// Определяем выйгравший вариант/варианты.
-	voteAmount := 0
+	voteAmount := uint64(0)
 	winOptions := make([]string, 0)
 	for k, v := range thread.Options {
-		if len(v) > voteAmount {
+		total, err := optionTotal(v, thread.Mode)
+		if err != nil {
+			return err
+		}
+
+		if total > voteAmount {
 			winOptions = append(winOptions, k)
 			winOptions = winOptions[len(winOptions)-1:]
 
-			voteAmount = len(v)
-		} else if len(v) == voteAmount {
+			voteAmount = total
+		} else if total == voteAmount {
 			winOptions = append(winOptions, k)
 		}
 	}
 
+	if len(winOptions) > 1 {
+		// Несколько вариантов разделили первое место - разрешаем ничью
+		// проверяемым образом через предоставленную запись beacon'а вместо
+		// того, чтобы отдавать все варианты как победившие.
+		closeTimestamp, err := ctx.GetStub().GetTxTimestamp()
+		if err != nil {
+			return fmt.Errorf("failed to get tx timestamp: %v", err)
+		}
+		if err := verifyAnonBeaconEntry(ctx, thread, endData.BeaconEntry, closeTimestamp.Seconds); err != nil {
+			return fmt.Errorf("failed to verify beacon entry: %v", err)
+		}
+
+		sortedTied := append([]string(nil), winOptions...)
+		sort.Strings(sortedTied)
+
+		thread.TiedOptions = sortedTied
+		thread.BeaconEntry = endData.BeaconEntry
+		winOptions = []string{pickAnonTiedWinner(endData.ThreadID, endData.BeaconEntry.Signature, sortedTied)}
+	}
+
 	thread.WinOption = winOptions
 
 	endedThreadJSON, _ := json.Marshal(thread)
@@ -307,8 +802,17 @@ func (s *SmartContract) EndAnonThread(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to end thread: %v", err)
 	}
 
-	// Записываем ивент о завершении голосования.
-	err = ctx.GetStub().SetEvent(fmt.Sprintf("EndAnonThread %s", endData.ThreadID), endedThreadJSON)
+	// Записываем типизированный ивент о завершении голосования.
+	winOption := ""
+	if len(thread.WinOption) == 1 {
+		winOption = thread.WinOption[0]
+	}
+	err = emitTypedEvent(ctx, AnonThreadClosed{
+		ThreadID:   endData.ThreadID,
+		Category:   thread.Category,
+		CreatorMSP: thread.CreatorMSP,
+		WinOption:  winOption,
+	})
 	if err != nil {
 		return fmt.Errorf("failed to set event of ending thread: %v", err)
 	}
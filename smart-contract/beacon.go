@@ -0,0 +1,193 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Тип ключа состояния для реестра доверенных источников внешней случайности.
+const beaconKeyType = "beacon"
+
+// BeaconRandomness - раунд внешнего beacon'а (в духе drand), использованный
+// для детерминированного разрешения ничьи в EndThread.
+type BeaconRandomness struct {
+	Round     uint64 `json:"round"`
+	Signature []byte `json:"signature"`
+	SourceID  string `json:"source_id"`
+}
+
+// BeaconSource - зарегистрированный доверенный источник случайности: его
+// публичный ключ и раунд, начиная с которого он считается действительным.
+// GenesisTime и Period позволяют вывести единственный ожидаемый раунд для
+// данного момента времени (см. expectedRound) - без этого создатель мог бы
+// перебирать уже опубликованные (а значит, предсказуемые) подписи прошлых
+// раундов в поисках выгодного исхода ничьи. Хранится в состоянии под ключом
+// beacon~<id>, как и прочие глобальные реестры в этом контракте (см.
+// setAssetStateBasedEndorsement).
+type BeaconSource struct {
+	ID          string `json:"id"`
+	PubKey      []byte `json:"pub_key"`
+	StartRound  uint64 `json:"start_round"`
+	GenesisTime int64  `json:"genesis_time"`
+	Period      int64  `json:"period"`
+}
+
+// expectedRound derives which round a given close-block timestamp must fall
+// in, the same way expectedBeaconRound does for AnonThread in anonBeacon.go.
+func expectedRound(source *BeaconSource, unixSeconds int64) uint64 {
+	if unixSeconds <= source.GenesisTime {
+		return source.StartRound
+	}
+	return source.StartRound + uint64((unixSeconds-source.GenesisTime)/source.Period)
+}
+
+// RegisterBeaconSource записывает доверенный публичный ключ внешнего
+// источника случайности в реестр канала. Предполагается, что этот метод
+// вызывается только администраторами канала как часть его настройки.
+func (s *SmartContract) RegisterBeaconSource(ctx contractapi.TransactionContextInterface, id string, pubKeyHex string, startRound uint64, genesisTime int64, period int64) error {
+	pubKey, err := hex.DecodeString(pubKeyHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode beacon public key: %v", err)
+	}
+	if len(pubKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("beacon public key must be %d bytes", ed25519.PublicKeySize)
+	}
+	if period <= 0 {
+		return fmt.Errorf("period must be positive")
+	}
+
+	source := BeaconSource{ID: id, PubKey: pubKey, StartRound: startRound, GenesisTime: genesisTime, Period: period}
+	sourceJSON, err := json.Marshal(source)
+	if err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(beaconKeyType, []string{id})
+	if err != nil {
+		return fmt.Errorf("failed to create beacon registry key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(key, sourceJSON)
+}
+
+// getBeaconSource loads a previously registered beacon source by ID.
+func getBeaconSource(ctx contractapi.TransactionContextInterface, id string) (*BeaconSource, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(beaconKeyType, []string{id})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create beacon registry key: %v", err)
+	}
+
+	sourceJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get beacon source %s: %v", id, err)
+	}
+	if sourceJSON == nil {
+		return nil, fmt.Errorf("beacon source %s is not registered", id)
+	}
+
+	var source BeaconSource
+	if err := json.Unmarshal(sourceJSON, &source); err != nil {
+		return nil, err
+	}
+
+	return &source, nil
+}
+
+// SetBeaconRound records the external randomness round that EndThread must
+// use to break a tie on threadID. It must be called by the thread's
+// creator before EndThread, and round must be the one expectedRound derives
+// from the current time - the creator cannot grind through already-public
+// signatures of past rounds looking for a favorable outcome, since only the
+// round matching right now is accepted.
+func (s *SmartContract) SetBeaconRound(ctx contractapi.TransactionContextInterface, threadID string, round uint64, sigHex string, sourceID string) error {
+	thread, err := s.QueryThread(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread from public state %v", err)
+	}
+
+	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+	if thread.Creator != clientID {
+		return fmt.Errorf("beacon round can only be set by the thread creator")
+	}
+	if thread.Status != "open" {
+		return fmt.Errorf("cannot set beacon round on a thread that is not open")
+	}
+
+	source, err := getBeaconSource(ctx, sourceID)
+	if err != nil {
+		return err
+	}
+	if round < source.StartRound {
+		return fmt.Errorf("round %d predates beacon source %s (starts at round %d)", round, sourceID, source.StartRound)
+	}
+
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get tx timestamp: %v", err)
+	}
+	if want := expectedRound(source, txTimestamp.Seconds); round != want {
+		return fmt.Errorf("round %d does not match the round %d derived from the current time for beacon source %s", round, want, sourceID)
+	}
+
+	sig, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode beacon signature: %v", err)
+	}
+	if err := verifyBeaconSignature(source.PubKey, round, sig); err != nil {
+		return fmt.Errorf("failed to verify beacon signature: %v", err)
+	}
+
+	thread.Randomness = &BeaconRandomness{Round: round, Signature: sig, SourceID: sourceID}
+
+	threadJSON, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(threadID, threadJSON)
+}
+
+// verifyBeaconSignature checks that sig is a valid signature over round,
+// issued by the beacon's registered public key. drand networks themselves
+// sign with BLS12-381 pairings; to keep this contract free of external
+// cryptography dependencies (it otherwise only uses the standard library),
+// registered beacon sources are expected to sign with ed25519 instead.
+func verifyBeaconSignature(pubKey []byte, round uint64, sig []byte) error {
+	message := []byte(fmt.Sprintf("%d", round))
+	if !ed25519.Verify(ed25519.PublicKey(pubKey), message, sig) {
+		return fmt.Errorf("signature does not match round %d for the registered beacon public key", round)
+	}
+	return nil
+}
+
+// pickTiedWinner deterministically derives a single winner out of a set of
+// tied option names using the thread's recorded beacon randomness: every
+// peer hashes (signature || threadID) and picks tiedOptions[seed mod n],
+// after sorting tiedOptions so the indexing itself is deterministic too.
+func pickTiedWinner(threadID string, randomness *BeaconRandomness, tiedOptions []string) (string, error) {
+	if randomness == nil {
+		return "", fmt.Errorf("thread is tied between %d options and has no beacon round set; call SetBeaconRound first", len(tiedOptions))
+	}
+
+	sorted := append([]string(nil), tiedOptions...)
+	sort.Strings(sorted)
+
+	seed := sha256.Sum256(append(append([]byte{}, randomness.Signature...), []byte(threadID)...))
+	index := new(big.Int).Mod(new(big.Int).SetBytes(seed[:]), big.NewInt(int64(len(sorted))))
+
+	return sorted[index.Int64()], nil
+}
@@ -0,0 +1,37 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import "testing"
+
+// commitmentHash is the pure sha256(optionID||nonce||userSecret) check
+// RevealVote runs against a voter's earlier CommitVote commitment; it is
+// the one piece of the commit-reveal flow that does not need a mocked
+// stub to exercise.
+func TestCommitmentHash(t *testing.T) {
+	want := commitmentHash("yes", "deadbeef", "user1")
+
+	if got := commitmentHash("yes", "deadbeef", "user1"); got != want {
+		t.Fatalf("commitmentHash is not deterministic: got %s, want %s", got, want)
+	}
+
+	cases := []struct {
+		name     string
+		optionID string
+		nonceHex string
+		userID   string
+	}{
+		{"different option", "no", "deadbeef", "user1"},
+		{"different nonce", "yes", "cafebabe", "user1"},
+		{"different user", "yes", "deadbeef", "user2"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := commitmentHash(c.optionID, c.nonceHex, c.userID); got == want {
+				t.Fatalf("commitmentHash(%q, %q, %q) collided with the original commitment", c.optionID, c.nonceHex, c.userID)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Тип ключа состояния для делегирования голоса.
+const delegationKeyType = "delegation"
+
+// allThreadsDelegationScope is used as the threadID of a delegation that
+// covers every poll not covered by a thread-specific delegation of the same
+// delegator, instead of a single thread. It is not limited to polls created
+// by any particular creator or organization.
+const allThreadsDelegationScope = "*"
+
+// maxDelegationChainDepth bounds how far DelegateVote walks an existing
+// delegation chain when checking for cycles.
+const maxDelegationChainDepth = 5
+
+// Delegation records that votes cast for Delegator on ThreadID may be
+// submitted by Delegate instead.
+type Delegation struct {
+	ThreadID  string `json:"thread_id"`
+	Delegator string `json:"delegator"`
+	Delegate  string `json:"delegate"`
+}
+
+func delegationKey(ctx contractapi.TransactionContextInterface, threadID, delegatorID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(delegationKeyType, []string{threadID, delegatorID})
+}
+
+func getDelegation(ctx contractapi.TransactionContextInterface, threadID, delegatorID string) (*Delegation, error) {
+	key, err := delegationKey(ctx, threadID, delegatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegation: %v", err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+
+	var delegation Delegation
+	if err := json.Unmarshal(data, &delegation); err != nil {
+		return nil, err
+	}
+
+	return &delegation, nil
+}
+
+// getActiveDelegate resolves who is currently entitled to vote on behalf of
+// delegatorID for threadID, checking a thread-specific delegation first and
+// falling back to a catch-all delegation scoped to every open poll.
+func getActiveDelegate(ctx contractapi.TransactionContextInterface, threadID, delegatorID string) (string, error) {
+	delegation, err := getDelegation(ctx, threadID, delegatorID)
+	if err != nil {
+		return "", err
+	}
+	if delegation == nil {
+		delegation, err = getDelegation(ctx, allThreadsDelegationScope, delegatorID)
+		if err != nil {
+			return "", err
+		}
+	}
+	if delegation == nil {
+		return "", fmt.Errorf("no active delegation from %s for thread %s", delegatorID, threadID)
+	}
+
+	return delegation.Delegate, nil
+}
+
+// hasVotedDirectly reports whether voterID already cast their own ballot
+// (as opposed to being represented by a delegate) in thread.
+func hasVotedDirectly(thread *Thread, voterID string) bool {
+	for _, votes := range thread.Options {
+		for _, vote := range votes {
+			if vote.Voter == voterID && vote.CastBy == voterID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasVotedByDelegate reports whether voterID is already represented by a
+// ballot some delegate cast on their behalf in thread - the mirror image of
+// hasVotedDirectly, so UseVote can reject a direct vote from voterID after a
+// delegate has already voted for them, not just the other way around.
+func hasVotedByDelegate(thread *Thread, voterID string) bool {
+	for _, votes := range thread.Options {
+		for _, vote := range votes {
+			if vote.Voter == voterID && vote.CastBy != voterID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DelegateVote lets the caller appoint delegateID to cast their vote on
+// threadID on their behalf - or, if threadID is allThreadsDelegationScope
+// ("*"), on every open poll not covered by a more specific delegation. A
+// bounded walk of the existing delegation chain rejects cycles.
+func (s *SmartContract) DelegateVote(ctx contractapi.TransactionContextInterface, threadID string, delegateID string) error {
+	delegatorID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return err
+	}
+	if delegatorID == delegateID {
+		return fmt.Errorf("cannot delegate a vote to yourself")
+	}
+
+	// Запрещаем циклы делегирования, проходя по существующей цепочке на ограниченную глубину.
+	current := delegateID
+	for depth := 0; depth < maxDelegationChainDepth; depth++ {
+		next, err := getActiveDelegate(ctx, threadID, current)
+		if err != nil {
+			break
+		}
+		if next == delegatorID {
+			return fmt.Errorf("delegating to %s would create a delegation cycle", delegateID)
+		}
+		current = next
+	}
+
+	key, err := delegationKey(ctx, threadID, delegatorID)
+	if err != nil {
+		return err
+	}
+
+	delegationJSON, err := json.Marshal(Delegation{ThreadID: threadID, Delegator: delegatorID, Delegate: delegateID})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, delegationJSON)
+}
+
+// RevokeDelegation cancels a previously created delegation for threadID.
+func (s *SmartContract) RevokeDelegation(ctx contractapi.TransactionContextInterface, threadID string) error {
+	delegatorID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	if err != nil {
+		return err
+	}
+
+	key, err := delegationKey(ctx, threadID, delegatorID)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return fmt.Errorf("failed to check existing delegation: %v", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("no delegation to revoke for thread %s", threadID)
+	}
+
+	return ctx.GetStub().DelState(key)
+}
+
+// QueryDelegationsForThread returns every delegation recorded directly
+// against threadID, so the delegation graph can be audited.
+func (s *SmartContract) QueryDelegationsForThread(ctx contractapi.TransactionContextInterface, threadID string) ([]Delegation, error) {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(delegationKeyType, []string{threadID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query delegations: %v", err)
+	}
+	defer iterator.Close()
+
+	delegations := make([]Delegation, 0)
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var delegation Delegation
+		if err := json.Unmarshal(entry.Value, &delegation); err != nil {
+			return nil, err
+		}
+
+		delegations = append(delegations, delegation)
+	}
+
+	return delegations, nil
+}
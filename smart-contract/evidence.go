@@ -0,0 +1,213 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Тип ключа состояния для реестра нарушителей, действующего во всех
+// голосованиях, созданных одной организацией (а не только в одном threadID).
+const disqualificationKeyType = "disqualification"
+
+// disqualificationKey scopes a disqualification to the organization that
+// created the offending thread, per SubmitAnonVoteEvidence's doc comment:
+// an identity caught equivocating once is barred from every anonymous
+// thread that organization creates, not just the one it was caught in.
+func disqualificationKey(ctx contractapi.TransactionContextInterface, creatorMSP string, userID string) (string, error) {
+	return ctx.GetStub().CreateCompositeKey(disqualificationKeyType, []string{creatorMSP, userID})
+}
+
+// isDisqualified reports whether userID has already been caught equivocating
+// in some anonymous thread created by creatorMSP, per a prior
+// SubmitAnonVoteEvidence call. CommitVote and UseAnonVote consult this
+// before accepting a new vote or commitment.
+func isDisqualified(ctx contractapi.TransactionContextInterface, creatorMSP string, userID string) (bool, error) {
+	key, err := disqualificationKey(ctx, creatorMSP, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to create disqualification key: %v", err)
+	}
+
+	data, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to get disqualification record: %v", err)
+	}
+
+	return data != nil, nil
+}
+
+// voteResolvesToUser reports whether txID's vote composite key for threadID
+// was written under userID, regardless of which organization's implicit
+// collection it was cast through - unlike reconstructing the key with the
+// caller's own collection, this lets a whistleblower from any org submit
+// evidence against a voter from any other org.
+func voteResolvesToUser(ctx contractapi.TransactionContextInterface, threadID string, txID string, userID string) error {
+	iterator, err := ctx.GetStub().GetStateByPartialCompositeKey(voteKeyType, []string{threadID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to query vote: %v", err)
+	}
+	defer iterator.Close()
+
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return err
+		}
+
+		_, parts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return err
+		}
+		if len(parts) == 4 && parts[3] == userID {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("transaction %s does not resolve to enrollment %s for thread %s", txID, userID, threadID)
+}
+
+// containsHash reports whether hashHex appears among hashes.
+func containsHash(hashes []string, hashHex string) bool {
+	for _, h := range hashes {
+		if h == hashHex {
+			return true
+		}
+	}
+	return false
+}
+
+// SubmitAnonVoteEvidence lets any client prove, by revealing two transient
+// AnonVote payloads for the same threadID and userID whose Option differs,
+// that userID (identified by hf.EnrollmentID) cast two conflicting votes on
+// the same anonymous thread. Both payloads must recompute to leaf hashes
+// already recorded in thread.Votes, and both matching vote-use transactions
+// must resolve to userID, in whichever org's implicit collection they were
+// recorded (see voteResolvesToUser), so evidence can only be forged by
+// someone who already controls two valid votes.
+//
+// On success the offender is disqualified from every future anonymous
+// thread created by the same organization (see isDisqualified), the two
+// offending leaves are struck from Votes and the Merkle tree is rebuilt from
+// the survivors, and a MaliciousAnonVote event records both transactions and
+// the accuser.
+func (s *SmartContract) SubmitAnonVoteEvidence(ctx contractapi.TransactionContextInterface, threadID string, userID string) error {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	voteAJSON, ok := transientMap["voteA"]
+	if !ok {
+		return fmt.Errorf("voteA key not found in the transient map")
+	}
+	voteBJSON, ok := transientMap["voteB"]
+	if !ok {
+		return fmt.Errorf("voteB key not found in the transient map")
+	}
+
+	var voteA, voteB AnonVote
+	if err := json.Unmarshal(voteAJSON, &voteA); err != nil {
+		return fmt.Errorf("error unmarshal voteA data transient: %v", err)
+	}
+	if err := json.Unmarshal(voteBJSON, &voteB); err != nil {
+		return fmt.Errorf("error unmarshal voteB data transient: %v", err)
+	}
+
+	if voteA.ThreadID != threadID || voteB.ThreadID != threadID {
+		return fmt.Errorf("both votes must target thread %s", threadID)
+	}
+	if voteA.TxID == voteB.TxID {
+		return fmt.Errorf("evidence requires two distinct transactions")
+	}
+	if voteA.Option == voteB.Option {
+		return fmt.Errorf("evidence requires votes for two different options")
+	}
+
+	thread, err := s.QueryAnonThread(ctx, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to get thread from public state %v", err)
+	}
+
+	hashA := hex.EncodeToString(merkleLeafHash(voteAJSON))
+	hashB := hex.EncodeToString(merkleLeafHash(voteBJSON))
+
+	if !containsHash(thread.Votes, hashA) {
+		return fmt.Errorf("voteA does not match a committed vote for thread %s", threadID)
+	}
+	if !containsHash(thread.Votes, hashB) {
+		return fmt.Errorf("voteB does not match a committed vote for thread %s", threadID)
+	}
+
+	// Проверяем, что обе транзакции голосования принадлежат одной и той же
+	// личности. Offender и accuser могут состоять в разных организациях, а
+	// voteKey закодирован с коллекцией организации голосовавшего, а не
+	// вызывающего, поэтому ищем по частичному ключу (threadID, txID) вместо
+	// того, чтобы подставлять собственную коллекцию accuser'а.
+	for _, txID := range []string{voteA.TxID, voteB.TxID} {
+		if err := voteResolvesToUser(ctx, threadID, txID, userID); err != nil {
+			return err
+		}
+	}
+
+	// Исключаем обе записи из Votes и пересчитываем дерево по оставшимся листьям.
+	remainingVotes := make([]string, 0, len(thread.Votes))
+	for _, hash := range thread.Votes {
+		if hash == hashA || hash == hashB {
+			continue
+		}
+		remainingVotes = append(remainingVotes, hash)
+	}
+	thread.Votes = remainingVotes
+
+	if err := rebuildMerkleTree(thread); err != nil {
+		return err
+	}
+
+	if thread.Disqualified == nil {
+		thread.Disqualified = make(map[string]bool)
+	}
+	thread.Disqualified[userID] = true
+
+	disqualKey, err := disqualificationKey(ctx, thread.CreatorMSP, userID)
+	if err != nil {
+		return fmt.Errorf("failed to create disqualification key: %v", err)
+	}
+	if err := ctx.GetStub().PutState(disqualKey, []byte{1}); err != nil {
+		return fmt.Errorf("failed to record disqualification: %v", err)
+	}
+
+	threadJSON, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().PutState(threadID, threadJSON); err != nil {
+		return fmt.Errorf("failed to update thread: %v", err)
+	}
+
+	accuser, err := s.GetSubmittingClientIdentity(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get client identity %v", err)
+	}
+
+	err = emitTypedEvent(ctx, MaliciousAnonVote{
+		ThreadID:   threadID,
+		Category:   thread.Category,
+		CreatorMSP: thread.CreatorMSP,
+		Offender:   userID,
+		Accuser:    accuser,
+		TxA:        voteA.TxID,
+		TxB:        voteB.TxID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set event of malicious vote: %v", err)
+	}
+
+	return nil
+}
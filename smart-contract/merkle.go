@@ -0,0 +1,211 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// merkleTreeDepth bounds the incremental Merkle tree backing AnonThread.Votes
+// at a fixed height, the same way Ethereum's deposit contract tree does, so
+// appends and root computation only ever touch O(depth) hashes regardless of
+// how many votes have been cast.
+const merkleTreeDepth = 32
+
+// zeroHashes[i] is the root of an empty subtree of height i, used to pad
+// levels above the real data when the tree is not perfectly balanced.
+var zeroHashes [merkleTreeDepth + 1][]byte
+
+func init() {
+	zeroHashes[0] = merkleLeafHash(nil)
+	for i := 1; i <= merkleTreeDepth; i++ {
+		zeroHashes[i] = merkleNodeHash(zeroHashes[i-1], zeroHashes[i-1])
+	}
+}
+
+// merkleLeafHash hashes leaf data with a 0x00 domain-separation prefix, per
+// RFC 6962, so a leaf hash can never be mistaken for an internal node hash.
+func merkleLeafHash(data []byte) []byte {
+	sum := sha256.Sum256(append([]byte{0x00}, data...))
+	return sum[:]
+}
+
+// merkleNodeHash hashes two children with a 0x01 domain-separation prefix.
+func merkleNodeHash(left, right []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{0x01}, left...), right...))
+	return sum[:]
+}
+
+// appendMerkleLeaf appends leafData as the next leaf of the incremental
+// tree tracked by thread (spine + root), in O(depth) rather than rehashing
+// every previously stored leaf, and returns the new leaf's hex-encoded hash.
+func appendMerkleLeaf(thread *AnonThread, leafData []byte) (string, error) {
+	leaf := merkleLeafHash(leafData)
+
+	if err := insertMerkleLeafHash(thread, leaf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(leaf), nil
+}
+
+// insertMerkleLeafHash inserts an already-hashed leaf into thread's
+// incremental tree. Shared by appendMerkleLeaf (hashing fresh vote data)
+// and rebuildMerkleTree (replaying already-hashed leaves after evidence of
+// equivocation removes some of them).
+func insertMerkleLeafHash(thread *AnonThread, leaf []byte) error {
+	spine := make([][]byte, merkleTreeDepth)
+	for i, s := range thread.Spine {
+		if s != "" {
+			decoded, err := hex.DecodeString(s)
+			if err != nil {
+				return fmt.Errorf("failed to decode stored spine hash: %v", err)
+			}
+			spine[i] = decoded
+		}
+	}
+
+	node := leaf
+	size := thread.LeafCount + 1
+	for height := 0; height < merkleTreeDepth; height++ {
+		if size&1 == 1 {
+			spine[height] = node
+			break
+		}
+		node = merkleNodeHash(spine[height], node)
+		size >>= 1
+	}
+
+	thread.LeafCount++
+	thread.Spine = make([]string, merkleTreeDepth)
+	for i, s := range spine {
+		if s != nil {
+			thread.Spine[i] = hex.EncodeToString(s)
+		}
+	}
+	thread.MerkleRoot = hex.EncodeToString(merkleRootFromSpine(spine, thread.LeafCount))
+
+	return nil
+}
+
+// rebuildMerkleTree resets thread's incremental tree and replays every
+// remaining entry of thread.Votes (already leaf-hashed) through it, in
+// order. Used after disqualifying an equivocating voter, since removing an
+// arbitrary leaf from an append-only tree requires recomputing the tree
+// from the surviving leaves.
+func rebuildMerkleTree(thread *AnonThread) error {
+	thread.Spine = make([]string, merkleTreeDepth)
+	thread.LeafCount = 0
+	thread.MerkleRoot = hex.EncodeToString(merkleRootFromSpine(make([][]byte, merkleTreeDepth), 0))
+
+	for _, leafHex := range thread.Votes {
+		leaf, err := hex.DecodeString(leafHex)
+		if err != nil {
+			return fmt.Errorf("failed to decode stored leaf hash: %v", err)
+		}
+		if err := insertMerkleLeafHash(thread, leaf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// merkleRootFromSpine bags the current spine of peaks into a single root,
+// padding every level above the real data with the matching zero hash.
+func merkleRootFromSpine(spine [][]byte, leafCount uint64) []byte {
+	node := zeroHashes[0]
+	size := leafCount
+	for height := 0; height < merkleTreeDepth; height++ {
+		if size&1 == 1 {
+			node = merkleNodeHash(spine[height], node)
+		} else {
+			node = merkleNodeHash(node, zeroHashes[height])
+		}
+		size >>= 1
+	}
+	return node
+}
+
+// staticMerkleRoot computes the root of a one-shot Merkle tree over leaves,
+// reusing the same leaf/node hashing and zero-padding rules as the
+// incremental tree above, for commitments (like ProposeEndAnonThread's
+// KeysMerkleRoot/TxsMerkleRoot) that are computed once and never appended to.
+func staticMerkleRoot(leaves [][]byte) []byte {
+	spine := make([][]byte, merkleTreeDepth)
+	size := uint64(0)
+	for _, leaf := range leaves {
+		node := leaf
+		size++
+		pos := size
+		for height := 0; height < merkleTreeDepth; height++ {
+			if pos&1 == 1 {
+				spine[height] = node
+				break
+			}
+			node = merkleNodeHash(spine[height], node)
+			pos >>= 1
+		}
+	}
+
+	return merkleRootFromSpine(spine, size)
+}
+
+// buildMerkleProof recomputes the audit path for leaves[index] from the
+// full ordered leaf set, mirroring appendMerkleLeaf's pairing rule so the
+// result verifies against the same root VerifyAnonVoteProof checks against.
+func buildMerkleProof(leaves [][]byte, index int) ([][]byte, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, fmt.Errorf("leaf index %d out of range", index)
+	}
+
+	path := make([][]byte, merkleTreeDepth)
+	level := append([][]byte(nil), leaves...)
+	idx := index
+
+	for height := 0; height < merkleTreeDepth; height++ {
+		if idx%2 == 0 {
+			if idx+1 < len(level) {
+				path[height] = level[idx+1]
+			} else {
+				path[height] = zeroHashes[height]
+			}
+		} else {
+			path[height] = level[idx-1]
+		}
+
+		nextLevel := make([][]byte, 0, (len(level)+1)/2)
+		for i := 0; i < len(level); i += 2 {
+			if i+1 < len(level) {
+				nextLevel = append(nextLevel, merkleNodeHash(level[i], level[i+1]))
+			} else {
+				nextLevel = append(nextLevel, merkleNodeHash(level[i], zeroHashes[height]))
+			}
+		}
+		level = nextLevel
+		idx /= 2
+	}
+
+	return path, nil
+}
+
+// verifyMerkleProof recomputes the root for leaf at index following path
+// and reports whether it matches root.
+func verifyMerkleProof(leaf []byte, index uint64, path [][]byte, root []byte) bool {
+	node := leaf
+	idx := index
+	for _, sibling := range path {
+		if idx%2 == 0 {
+			node = merkleNodeHash(node, sibling)
+		} else {
+			node = merkleNodeHash(sibling, node)
+		}
+		idx /= 2
+	}
+
+	return hex.EncodeToString(node) == hex.EncodeToString(root)
+}
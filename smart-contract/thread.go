@@ -9,21 +9,35 @@ import (
 	"fmt"
 
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/restlesswhy/hyperledger-fabric-voter-chaincode/events"
 )
 
 type SmartContract struct {
 	contractapi.Contract
 }
 
+// Vote фиксирует, кто отдал голос за вариант, и, если голос был отдан через
+// делегирование, чья личность фактически отправила транзакцию.
+type Vote struct {
+	Voter  string `json:"voter"`
+	CastBy string `json:"cast_by"`
+}
+
 // Сущность голосвания
 type Thread struct {
-	Category    string              `json:"category"`
-	Theme       string              `json:"theme"`
-	Description string              `json:"description"`
-	Creator     string              `json:"creator"`
-	Options     map[string][]string `json:"options"`
-	WinOption   []string            `json:"win_option"`
-	Status      string              `json:"status"`
+	Category    string            `json:"category"`
+	Theme       string            `json:"theme"`
+	Description string            `json:"description"`
+	Creator     string            `json:"creator"`
+	CreatorMSP  string            `json:"creator_msp"`
+	Options     map[string][]Vote `json:"options"`
+	WinOption   []string          `json:"win_option"`
+	Status      string            `json:"status"`
+	// Randomness holds the external beacon round used by EndThread to break
+	// a tie between top options, set in advance via SetBeaconRound. It is
+	// nil unless SetBeaconRound was called; EndThread only consults it when
+	// the top options are tied.
+	Randomness *BeaconRandomness `json:"randomness,omitempty"`
 }
 
 const voteKeyType = "vote"
@@ -63,10 +77,10 @@ func (s *SmartContract) CreateThread(ctx contractapi.TransactionContextInterface
 	}
 
 	// Создаем структуру голосвания
-	threadOptions := make(map[string][]string)
+	threadOptions := make(map[string][]Vote)
 
 	for _, option := range options {
-		threadOptions[option] = make([]string, 0)
+		threadOptions[option] = make([]Vote, 0)
 	}
 
 	tread := Thread{
@@ -74,6 +88,7 @@ func (s *SmartContract) CreateThread(ctx contractapi.TransactionContextInterface
 		Theme:       theme,
 		Description: description,
 		Creator:     clientID,
+		CreatorMSP:  clientOrgID,
 		Options:     threadOptions,
 		WinOption:   []string{},
 		Status:      "open",
@@ -96,8 +111,26 @@ func (s *SmartContract) CreateThread(ctx contractapi.TransactionContextInterface
 		return fmt.Errorf("failed setting state based endorsement for new organization: %v", err)
 	}
 
-	// Записываем ивент создания голосования.
-	err = ctx.GetStub().SetEvent(fmt.Sprintf("CreateThread %s", threadID), threadJSON)
+	// Индексируем голосование по category~status~id для быстрых выборок без полного сканирования.
+	err = indexThread(ctx, category, tread.Status, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to index new thread: %v", err)
+	}
+
+	// Записываем типизированный ивент создания голосования с индексированными топиками.
+	createdPayload, err := json.Marshal(events.ThreadCreatedEvent{
+		ThreadID:    threadID,
+		Category:    category,
+		CreatorMSP:  clientOrgID,
+		Theme:       theme,
+		Description: description,
+		Options:     options,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(events.BuildThreadCreatedName(threadID, category, clientOrgID), createdPayload)
 	if err != nil {
 		return fmt.Errorf("failed to set event of creating thread: %v", err)
 	}
@@ -164,8 +197,10 @@ func (s *SmartContract) CreateVote(ctx contractapi.TransactionContextInterface,
 	return txID, nil
 }
 
-// Применяет голос к сущности.
-func (s *SmartContract) UseVote(ctx contractapi.TransactionContextInterface, threadID string, txID string, option string) error {
+// Применяет голос к сущности. onBehalfOf пустой означает, что голосующий
+// голосует за себя; если указан, вызывающий должен быть активным делегатом
+// onBehalfOf для этого голосования (см. DelegateVote).
+func (s *SmartContract) UseVote(ctx contractapi.TransactionContextInterface, threadID string, txID string, option string, onBehalfOf string) error {
 
 	// Загружаем сущность голосования из блокчейна.
 	thread, err := s.QueryThread(ctx, threadID)
@@ -185,14 +220,33 @@ func (s *SmartContract) UseVote(ctx contractapi.TransactionContextInterface, thr
 		return fmt.Errorf("failed to get implicit collection name: %v", err)
 	}
 
-	// Получаем ID пользователя
-	userID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
+	// Получаем ID вызывающего.
+	callerID, _, err := ctx.GetClientIdentity().GetAttributeValue("hf.EnrollmentID")
 	if err != nil {
 		return err
 	}
 
+	// Если указан делегирующий, проверяем, что вызывающий - его активный
+	// делегат, и что делегирующий еще не голосовал напрямую.
+	voterID := callerID
+	if onBehalfOf != "" && onBehalfOf != callerID {
+		delegate, err := getActiveDelegate(ctx, threadID, onBehalfOf)
+		if err != nil {
+			return err
+		}
+		if delegate != callerID {
+			return fmt.Errorf("caller is not the active delegate for %s on thread %s", onBehalfOf, threadID)
+		}
+		if hasVotedDirectly(thread, onBehalfOf) {
+			return fmt.Errorf("delegator %s has already voted directly and cannot be represented by a delegate", onBehalfOf)
+		}
+		voterID = onBehalfOf
+	} else if hasVotedByDelegate(thread, voterID) {
+		return fmt.Errorf("caller %s has already been represented by a delegate and cannot vote directly", voterID)
+	}
+
 	// Создаем композитный ключ.
-	voteKey, err := ctx.GetStub().CreateCompositeKey(voteKeyType, []string{threadID, txID, collection, userID})
+	voteKey, err := ctx.GetStub().CreateCompositeKey(voteKeyType, []string{threadID, txID, collection, voterID})
 	if err != nil {
 		return fmt.Errorf("failed to create composite key: %v", err)
 	}
@@ -214,7 +268,7 @@ func (s *SmartContract) UseVote(ctx contractapi.TransactionContextInterface, thr
 	}
 
 	// Добавляем голос к выбранному варианту и загружаем в блокчейн.
-	thread.Options[option] = append(thread.Options[option], userID)
+	thread.Options[option] = append(thread.Options[option], Vote{Voter: voterID, CastBy: callerID})
 
 	threadJSON, err := json.Marshal(thread)
 	if err != nil {
@@ -233,8 +287,19 @@ func (s *SmartContract) UseVote(ctx contractapi.TransactionContextInterface, thr
 		return fmt.Errorf("failed to update auction: %v", err)
 	}
 
-	// Отправляем ивент о оспользовании голоса
-	err = ctx.GetStub().SetEvent(fmt.Sprintf("UseVote %s", threadID), threadJSON)
+	// Отправляем типизированный ивент о использовании голоса с топиком по категории и хэшу варианта.
+	voteCastPayload, err := json.Marshal(events.VoteCastEvent{
+		ThreadID:   threadID,
+		Category:   thread.Category,
+		Option:     option,
+		CreatorMSP: thread.CreatorMSP,
+		VoterID:    voterID,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(events.BuildVoteCastName(threadID, thread.Category, option, thread.CreatorMSP), voteCastPayload)
 	if err != nil {
 		return fmt.Errorf("failed to set event of using vote: %v", err)
 	}
@@ -269,18 +334,29 @@ func (s *SmartContract) EndThread(ctx contractapi.TransactionContextInterface, t
 		return fmt.Errorf("cannot close thread that is not open")
 	}
 
-	// Определяем победителя/победителей.
+	// Определяем вариант(ы) с наибольшим числом голосов.
 	voteAmount := 0
-	winOptions := make([]string, 0)
+	tiedOptions := make([]string, 0)
 	for k, v := range thread.Options {
 		if len(v) > voteAmount {
-			winOptions = append(winOptions, k)
-			winOptions = winOptions[len(winOptions)-1:]
-
+			tiedOptions = []string{k}
 			voteAmount = len(v)
 		} else if len(v) == voteAmount {
-			winOptions = append(winOptions, k)
+			tiedOptions = append(tiedOptions, k)
+		}
+	}
+
+	winOptions := tiedOptions
+	if len(tiedOptions) > 1 {
+		// Ничья: выбираем единственного победителя детерминированно по
+		// beacon-раунду, зафиксированному через SetBeaconRound, так что все
+		// пиры получают один и тот же результат. Пока голосование открыто,
+		// создатель может перезаписать раунд повторным вызовом SetBeaconRound.
+		winner, err := pickTiedWinner(threadID, thread.Randomness, tiedOptions)
+		if err != nil {
+			return err
 		}
+		winOptions = []string{winner}
 	}
 
 	// Записываем победителя и выгружаем в блокчейн.
@@ -294,8 +370,24 @@ func (s *SmartContract) EndThread(ctx contractapi.TransactionContextInterface, t
 		return fmt.Errorf("failed to end thread: %v", err)
 	}
 
-	// Записываем ивент о закрытии голосования.
-	err = ctx.GetStub().SetEvent(fmt.Sprintf("EndThread %s", threadID), endedThreadJSON)
+	// Переносим запись в индексе category~status~id на новый статус.
+	err = reindexThreadStatus(ctx, thread.Category, status, thread.Status, threadID)
+	if err != nil {
+		return fmt.Errorf("failed to reindex ended thread: %v", err)
+	}
+
+	// Записываем типизированный ивент о закрытии голосования.
+	closedPayload, err := json.Marshal(events.ThreadClosedEvent{
+		ThreadID:   threadID,
+		Category:   thread.Category,
+		CreatorMSP: thread.CreatorMSP,
+		WinOptions: winOptions,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().SetEvent(events.BuildThreadClosedName(threadID, thread.Category, thread.CreatorMSP), closedPayload)
 	if err != nil {
 		return fmt.Errorf("failed to set event of ending thread: %v", err)
 	}
@@ -7,10 +7,39 @@ package auction
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 )
 
+// Тип композитного индекса для поиска голосований по категории и статусу.
+const threadIndexType = "thread~category~status~id"
+
+// Добавляет запись о голосовании в композитный индекс category~status~id.
+func indexThread(ctx contractapi.TransactionContextInterface, category, status, threadID string) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(threadIndexType, []string{category, status, threadID})
+	if err != nil {
+		return fmt.Errorf("failed to create thread index key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+// Переносит запись голосования в индексе из одного статуса в другой.
+func reindexThreadStatus(ctx contractapi.TransactionContextInterface, category, oldStatus, newStatus, threadID string) error {
+	oldIndexKey, err := ctx.GetStub().CreateCompositeKey(threadIndexType, []string{category, oldStatus, threadID})
+	if err != nil {
+		return fmt.Errorf("failed to create thread index key: %v", err)
+	}
+
+	if err := ctx.GetStub().DelState(oldIndexKey); err != nil {
+		return fmt.Errorf("failed to delete stale thread index entry: %v", err)
+	}
+
+	return indexThread(ctx, category, newStatus, threadID)
+}
+
 // Зегрузть сущность из блокчейна.
 func (s *SmartContract) QueryThread(ctx contractapi.TransactionContextInterface, threadID string) (*Thread, error) {
 
@@ -48,4 +77,182 @@ func (s *SmartContract) QueryAnonThread(ctx contractapi.TransactionContextInterf
 	}
 
 	return thread, nil
-}
\ No newline at end of file
+}
+
+// AttributeFilter is a single equality filter applied to a Thread's CouchDB
+// JSON document, e.g. {Field: "category", Value: "sports"}.
+type AttributeFilter struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+// ThreadPage is a page of threads returned by a paginated rich query,
+// together with the bookmark needed to fetch the next page.
+type ThreadPage struct {
+	Threads      []*Thread `json:"threads"`
+	Bookmark     string    `json:"bookmark"`
+	FetchedCount int32     `json:"fetched_count"`
+}
+
+// HistoryQueryResult is a single modification of a thread as recorded on the
+// ledger, used to build a browsable history of a poll.
+type HistoryQueryResult struct {
+	TxID      string  `json:"tx_id"`
+	Timestamp string  `json:"timestamp"`
+	IsDelete  bool    `json:"is_delete"`
+	Thread    *Thread `json:"thread"`
+}
+
+// QueryThreadsByAttributes runs a CouchDB rich query matching threads whose
+// JSON document satisfies every filter. It requires CouchDB as the state
+// database.
+func (s *SmartContract) QueryThreadsByAttributes(ctx contractapi.TransactionContextInterface, filters []AttributeFilter) ([]*Thread, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("at least one attribute filter is required")
+	}
+
+	selector := make(map[string]interface{}, len(filters))
+	for _, filter := range filters {
+		selector[filter.Field] = filter.Value
+	}
+
+	queryJSON, err := json.Marshal(map[string]interface{}{"selector": selector})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetQueryResult(string(queryJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to run attribute query: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	return threadsFromIterator(resultsIterator)
+}
+
+// QueryThreadsByCategory returns a page of threads in category, optionally
+// narrowed down to a single status, using the thread~category~status~id
+// composite index so the query stays efficient regardless of state database.
+func (s *SmartContract) QueryThreadsByCategory(ctx contractapi.TransactionContextInterface, category, statusOpt string, pageSize int32, bookmark string) (*ThreadPage, error) {
+	attributes := []string{category}
+	if statusOpt != "" {
+		attributes = append(attributes, statusOpt)
+	}
+
+	iterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(threadIndexType, attributes, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query threads by category: %v", err)
+	}
+	defer iterator.Close()
+
+	threads := make([]*Thread, 0)
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(entry.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		threadID := keyParts[len(keyParts)-1]
+		thread, err := s.QueryThread(ctx, threadID)
+		if err != nil {
+			return nil, err
+		}
+
+		threads = append(threads, thread)
+	}
+
+	return &ThreadPage{
+		Threads:      threads,
+		Bookmark:     metadata.Bookmark,
+		FetchedCount: metadata.FetchedRecordsCount,
+	}, nil
+}
+
+// QueryThreadsByCreator returns a page of threads created by creatorID,
+// using a CouchDB rich query over the creator field.
+func (s *SmartContract) QueryThreadsByCreator(ctx contractapi.TransactionContextInterface, creatorID string, pageSize int32, bookmark string) (*ThreadPage, error) {
+	queryJSON, err := json.Marshal(map[string]interface{}{
+		"selector": map[string]interface{}{"creator": creatorID},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, metadata, err := ctx.GetStub().GetQueryResultWithPagination(string(queryJSON), pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query threads by creator: %v", err)
+	}
+	defer resultsIterator.Close()
+
+	threads, err := threadsFromIterator(resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ThreadPage{
+		Threads:      threads,
+		Bookmark:     metadata.Bookmark,
+		FetchedCount: metadata.FetchedRecordsCount,
+	}, nil
+}
+
+// GetHistoryForThread returns every recorded modification of threadID, in
+// chronological order, so that front-ends can build a browsable explorer
+// over a poll's history.
+func (s *SmartContract) GetHistoryForThread(ctx contractapi.TransactionContextInterface, threadID string) ([]HistoryQueryResult, error) {
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get history for thread %v: %v", threadID, err)
+	}
+	defer resultsIterator.Close()
+
+	history := make([]HistoryQueryResult, 0)
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var thread *Thread
+		if !modification.IsDelete {
+			if err := json.Unmarshal(modification.Value, &thread); err != nil {
+				return nil, err
+			}
+		}
+
+		history = append(history, HistoryQueryResult{
+			TxID:      modification.TxId,
+			Timestamp: time.Unix(modification.Timestamp.Seconds, int64(modification.Timestamp.Nanos)).String(),
+			IsDelete:  modification.IsDelete,
+			Thread:    thread,
+		})
+	}
+
+	return history, nil
+}
+
+// threadsFromIterator drains a query iterator of raw thread JSON documents
+// into Thread values, shared by every rich-query method above.
+func threadsFromIterator(iterator shim.StateQueryIteratorInterface) ([]*Thread, error) {
+	threads := make([]*Thread, 0)
+	for iterator.HasNext() {
+		entry, err := iterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var thread *Thread
+		if err := json.Unmarshal(entry.Value, &thread); err != nil {
+			return nil, err
+		}
+
+		threads = append(threads, thread)
+	}
+
+	return threads, nil
+}
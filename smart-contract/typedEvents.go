@@ -0,0 +1,155 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package auction
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// typedEvent is implemented by every event emitted via emitTypedEvent.
+// Name is the stable event name every instance of the type shares (unlike
+// the ad-hoc "Verb thread-id" names used elsewhere in this package), so a
+// listener can subscribe once instead of matching a dynamic per-thread
+// name. Topics returns the type's indexed fields, in a fixed declared
+// order, to be hashed into the topic header; Data returns everything else,
+// to be serialized as the event's payload.
+type typedEvent interface {
+	Name() string
+	Topics() []string
+	Data() interface{}
+}
+
+// typedEventEnvelope is the wire format emitTypedEvent writes: Topics[0] is
+// the event name, Topics[1:] are the hex sha256 digest of each indexed
+// field in declaration order (mirroring go-ethereum/abigen's indexed event
+// topics, where an indexed dynamic-length field is only ever recoverable as
+// a hash), and Data carries the rest.
+type typedEventEnvelope struct {
+	Topics []string        `json:"topics"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// emitTypedEvent serializes ev's indexed fields into a canonical
+// topic0..topicN header and emits it, prepended to ev's Data payload, under
+// ev.Name() - a single stable name per type, so pkg/auctionevents can
+// subscribe once and filter on topic hashes instead of re-registering per
+// thread.
+func emitTypedEvent(ctx contractapi.TransactionContextInterface, ev typedEvent) error {
+	topics := make([]string, 0, len(ev.Topics())+1)
+	topics = append(topics, ev.Name())
+	for _, value := range ev.Topics() {
+		sum := sha256.Sum256([]byte(value))
+		topics = append(topics, hex.EncodeToString(sum[:]))
+	}
+
+	dataJSON, err := json.Marshal(ev.Data())
+	if err != nil {
+		return err
+	}
+
+	envelopeJSON, err := json.Marshal(typedEventEnvelope{Topics: topics, Data: dataJSON})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().SetEvent(ev.Name(), envelopeJSON)
+}
+
+// AnonThreadCreated is emitted by CreateAnonThread. ThreadID, Category and
+// CreatorMSP are indexed.
+type AnonThreadCreated struct {
+	ThreadID    string
+	Category    string
+	CreatorMSP  string
+	Theme       string
+	Description string
+	Mode        string
+}
+
+func (e AnonThreadCreated) Name() string { return "AnonThreadCreated" }
+
+func (e AnonThreadCreated) Topics() []string {
+	return []string{e.ThreadID, e.Category, e.CreatorMSP}
+}
+
+func (e AnonThreadCreated) Data() interface{} {
+	return struct {
+		Theme       string `json:"theme"`
+		Description string `json:"description"`
+		Mode        string `json:"mode"`
+	}{e.Theme, e.Description, e.Mode}
+}
+
+// AnonVoteCast is emitted by UseAnonVote. ThreadID, Category, CreatorMSP and
+// Option are indexed; Option is never carried in the clear so that casting a
+// vote stays anonymous even to a listener who can match the topic.
+type AnonVoteCast struct {
+	ThreadID   string
+	Category   string
+	CreatorMSP string
+	Option     string
+}
+
+func (e AnonVoteCast) Name() string { return "AnonVoteCast" }
+
+func (e AnonVoteCast) Topics() []string {
+	return []string{e.ThreadID, e.Category, e.CreatorMSP, e.Option}
+}
+
+func (e AnonVoteCast) Data() interface{} {
+	return struct{}{}
+}
+
+// AnonThreadClosed is emitted by EndAnonThread. ThreadID, Category,
+// CreatorMSP and WinOption are indexed; WinOption is also carried in Data so
+// a listener who already knows threadID can read off the result.
+type AnonThreadClosed struct {
+	ThreadID   string
+	Category   string
+	CreatorMSP string
+	WinOption  string
+}
+
+func (e AnonThreadClosed) Name() string { return "AnonThreadClosed" }
+
+func (e AnonThreadClosed) Topics() []string {
+	return []string{e.ThreadID, e.Category, e.CreatorMSP, e.WinOption}
+}
+
+func (e AnonThreadClosed) Data() interface{} {
+	return struct {
+		WinOption string `json:"win_option"`
+	}{e.WinOption}
+}
+
+// MaliciousAnonVote is emitted by SubmitAnonVoteEvidence. ThreadID,
+// Category, CreatorMSP and Offender are indexed.
+type MaliciousAnonVote struct {
+	ThreadID   string
+	Category   string
+	CreatorMSP string
+	Offender   string
+	Accuser    string
+	TxA        string
+	TxB        string
+}
+
+func (e MaliciousAnonVote) Name() string { return "MaliciousAnonVote" }
+
+func (e MaliciousAnonVote) Topics() []string {
+	return []string{e.ThreadID, e.Category, e.CreatorMSP, e.Offender}
+}
+
+func (e MaliciousAnonVote) Data() interface{} {
+	return struct {
+		Accuser string `json:"accuser"`
+		TxA     string `json:"tx_a"`
+		TxB     string `json:"tx_b"`
+	}{e.Accuser, e.TxA, e.TxB}
+}